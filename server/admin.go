@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"social-network-study/model/auth"
+	"social-network-study/model/user"
+)
+
+/**
+Subcommand managing users without SQL:
+  server user create [flags] LOGIN           create user
+  server user delete LOGIN                   delete user with friendships
+  server user reset-password [flags] LOGIN   set new password
+Password is generated and printed when it is not given
+*/
+func userCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, "Usage: %s user create | delete | reset-password [flags] LOGIN\n", os.Args[0])
+		os.Exit(2)
+	}
+	action, args := args[0], args[1:]
+	ctx := context.Background()
+
+	switch action {
+	case "create":
+		flags := newFlagSet("user create", "LOGIN")
+		password := flags.String("password", "", "Password, generated when empty")
+		firstName := flags.String("first-name", "Admin", "First name")
+		lastName := flags.String("last-name", "Admin", "Last name")
+		birthDay := flags.String("birthday", "1970-01-01", "Birthday as YYYY-MM-DD")
+		cfg := loadConfig(flags, args)
+		if cfg == nil {
+			return
+		}
+		login := requireArgs(flags, 1)[0]
+		connect(cfg, false)
+		defer disconnect()
+
+		newPassword := passwordOrGenerated(*password)
+		newUser := &user.User{Login: login, Password: newPassword, FirstName: *firstName, LastName: *lastName, BirthDay: *birthDay}
+		created, err := user.Register(ctx, newUser)
+		if err != nil {
+			log.Fatalf("Cannot create user... %v", err)
+		}
+		fmt.Printf("Created user %s with id %d\n", created.Login, created.ID)
+		if *password == "" {
+			fmt.Printf("Password: %s\n", newPassword)
+		}
+	case "delete":
+		flags := newFlagSet("user delete", "LOGIN")
+		cfg := loadConfig(flags, args)
+		if cfg == nil {
+			return
+		}
+		login := requireArgs(flags, 1)[0]
+		connect(cfg, false)
+		defer disconnect()
+
+		found := existingUser(ctx, login)
+		if _, err := user.DeleteById(ctx, found.ID); err != nil {
+			log.Fatalf("Cannot delete user... %v", err)
+		}
+		fmt.Printf("Deleted user %s with id %d\n", found.Login, found.ID)
+	case "reset-password":
+		flags := newFlagSet("user reset-password", "LOGIN")
+		password := flags.String("password", "", "New password, generated when empty")
+		cfg := loadConfig(flags, args)
+		if cfg == nil {
+			return
+		}
+		login := requireArgs(flags, 1)[0]
+		connect(cfg, false)
+		defer disconnect()
+
+		credentials := &user.Credentials{Login: login, Password: passwordOrGenerated(*password)}
+		updated, err := user.ResetPassword(ctx, credentials)
+		if err != nil {
+			log.Fatalf("Cannot reset password... %v", err)
+		}
+		if !updated {
+			log.Fatalf("User %s not found", login)
+		}
+		fmt.Printf("Password of %s was reset\n", login)
+		if *password == "" {
+			fmt.Printf("Password: %s\n", credentials.Password)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown user command %q, expected create, delete or reset-password\n", action)
+		os.Exit(2)
+	}
+}
+
+/**
+Subcommand issuing token of existing user for debugging:
+  server token issue LOGIN
+*/
+func tokenCommand(args []string) {
+	if len(args) == 0 || args[0] != "issue" {
+		fmt.Fprintf(os.Stderr, "Usage: %s token issue [flags] LOGIN\n", os.Args[0])
+		os.Exit(2)
+	}
+	flags := newFlagSet("token issue", "LOGIN")
+	cfg := loadConfig(flags, args[1:])
+	if cfg == nil {
+		return
+	}
+	login := requireArgs(flags, 1)[0]
+	auth.Init(cfg)
+	connect(cfg, false)
+	defer disconnect()
+
+	found := existingUser(context.Background(), login)
+	token, err := auth.CreateToken(found.ID, found.Login)
+	if err != nil {
+		log.Fatalf("Cannot issue token... %v", err)
+	}
+	fmt.Println(token)
+}
+
+func existingUser(ctx context.Context, login string) *user.User {
+	found, err := user.FetchUserByLogin(ctx, login)
+	if err != nil {
+		log.Fatalf("Cannot find user... %v", err)
+	}
+	if found.ID == 0 {
+		log.Fatalf("User %s not found", login)
+	}
+	return found
+}
+
+func passwordOrGenerated(password string) string {
+	if password != "" {
+		return password
+	}
+	random := make([]byte, 12)
+	if _, err := rand.Read(random); err != nil {
+		log.Fatalf("Cannot generate password... %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(random)
+}
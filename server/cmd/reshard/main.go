@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"social-network-study/config"
+	"social-network-study/logging"
+	"social-network-study/model/dialog"
+)
+
+/**
+Tool for moving dialogs between shards:
+  reshard -dialog 1:2 -to shard-hot   move one (hot) dialog
+  reshard -rebalance                  move dialogs to their owners on the ring
+*/
+func main() {
+	key := flag.String("dialog", "", "Key of dialog to move, e.g. 1:2")
+	target := flag.String("to", "", "Name of target shard")
+	rebalance := flag.Bool("rebalance", false, "Move every dialog to the shard owning it on the ring")
+	batchSize := flag.Int("batch", 1000, "Number of messages copied at once")
+
+	cfg, err := config.InitConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("Cannot print configuration... %v", err)
+		}
+		return
+	}
+	logging.Init(cfg)
+	config.ConnectDataBase(cfg)
+	defer config.CloseDataBase()
+	config.ConnectShards(cfg)
+	defer config.CloseShards()
+	if err := config.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema is behind migrations, run migrate up... %v", err)
+	}
+
+	options := dialog.MoveOptions{BatchSize: *batchSize}
+	switch {
+	case *rebalance:
+		if err := dialog.Rebalance(options); err != nil {
+			log.Fatalf("Rebalance failed... %v", err)
+		}
+	case *key != "" && *target != "":
+		if err := dialog.MoveDialog(*key, *target, options); err != nil {
+			log.Fatalf("Move failed... %v", err)
+		}
+	default:
+		flag.Usage()
+		return
+	}
+	log.Info("Resharding finished")
+}
@@ -1,86 +1,332 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"gopkg.in/yaml.v2"
-	"log"
+	"io"
 	"os"
+	"strings"
+	"time"
 )
 
+/**
+ * Settings are layered, every layer overrides the previous one:
+ * defaults < config file < environment < command line flags.
+ * Every setting has an env variable and a flag named by its path,
+ * e.g. DB_HOSTS and --database.hosts
+ */
+
+const defaultConfigFile = "config.yaml"
+
+/**
+Policy of the client application: its own scripts, inline
+styles of components and Google fonts
+*/
+const defaultContentSecurityPolicy = "default-src 'self'; script-src 'self'; " +
+	"style-src 'self' 'unsafe-inline' https://fonts.googleapis.com; font-src 'self' https://fonts.gstatic.com; " +
+	"img-src 'self' data:; connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+/* Layout of dates in settings */
+const DateFormat = "2006-01-02"
+
 type Config struct {
 	Server struct {
-		Port string `yaml:"port"`
+		Port              string        `yaml:"port" env:"PORT"`
+		GrpcPort          string        `yaml:"grpcPort" env:"GRPC_PORT"`
+		ReadTimeout       time.Duration `yaml:"readTimeout" env:"SERVER_READ_TIMEOUT"`
+		ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+		WriteTimeout      time.Duration `yaml:"writeTimeout" env:"SERVER_WRITE_TIMEOUT"`
+		IdleTimeout       time.Duration `yaml:"idleTimeout" env:"SERVER_IDLE_TIMEOUT"`
+		ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+		OpenAPI           string        `yaml:"openapi" env:"OPENAPI_FILE"`
+		ValidateAPI       bool          `yaml:"validateApi" env:"SERVER_VALIDATE_API"`
+		V1Sunset          string        `yaml:"v1Sunset" env:"SERVER_V1_SUNSET"`
+		TLS               struct {
+			CertFile       string        `yaml:"certFile" env:"SERVER_TLS_CERT_FILE"`
+			KeyFile        string        `yaml:"keyFile" env:"SERVER_TLS_KEY_FILE"`
+			ReloadInterval time.Duration `yaml:"reloadInterval" env:"SERVER_TLS_RELOAD_INTERVAL"`
+			RedirectPort   string        `yaml:"redirectPort" env:"SERVER_TLS_REDIRECT_PORT"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
 	Database struct {
-		Username string `yaml:"user"`
-		Password string `yaml:"pass"`
-		Hosts     []string `yaml:"hosts"`
-		Name     string `yaml:"name"`
+		Username         string        `yaml:"user" env:"DB_USERNAME"`
+		Password         string        `yaml:"pass" env:"DB_PASSWORD" secret:"true"`
+		Hosts            []string      `yaml:"hosts" env:"DB_HOSTS"`
+		Primary          string        `yaml:"primary" env:"DB_PRIMARY"`
+		Name             string        `yaml:"name" env:"DB_NAME"`
+		ReplicaLagBudget time.Duration `yaml:"replicaLagBudget" env:"DB_REPLICA_LAG_BUDGET"`
+		ConnectRetry     time.Duration `yaml:"connectRetry" env:"DB_CONNECT_RETRY"`
+		Migrations       string        `yaml:"migrations" env:"DB_MIGRATIONS" flag:"migration.files"`
+		AutoMigrate      bool          `yaml:"autoMigrate" env:"DB_AUTO_MIGRATE"`
+		HostOptions      `yaml:",inline"`
+		PerHost          map[string]map[string]interface{} `yaml:"perHost" env:"DB_PER_HOST"`
 	} `yaml:"database"`
+	Cors struct {
+		AllowedOrigins   []string      `yaml:"allowedOrigins" env:"CORS_ALLOWED_ORIGINS"`
+		AllowedMethods   []string      `yaml:"allowedMethods" env:"CORS_ALLOWED_METHODS"`
+		AllowedHeaders   []string      `yaml:"allowedHeaders" env:"CORS_ALLOWED_HEADERS"`
+		ExposedHeaders   []string      `yaml:"exposedHeaders" env:"CORS_EXPOSED_HEADERS"`
+		AllowCredentials bool          `yaml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+		MaxAge           time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE"`
+	} `yaml:"cors"`
+	Headers struct {
+		ContentSecurityPolicy string        `yaml:"contentSecurityPolicy" env:"HEADERS_CONTENT_SECURITY_POLICY"`
+		HstsMaxAge            time.Duration `yaml:"hstsMaxAge" env:"HEADERS_HSTS_MAX_AGE"`
+		FrameOptions          string        `yaml:"frameOptions" env:"HEADERS_FRAME_OPTIONS"`
+		ReferrerPolicy        string        `yaml:"referrerPolicy" env:"HEADERS_REFERRER_POLICY"`
+	} `yaml:"headers"`
+	Auth struct {
+		AccessTokenTtl  time.Duration `yaml:"accessTokenTtl" env:"AUTH_ACCESS_TOKEN_TTL"`
+		RefreshTokenTtl time.Duration `yaml:"refreshTokenTtl" env:"AUTH_REFRESH_TOKEN_TTL"`
+		Cookies         bool          `yaml:"cookies" env:"AUTH_COOKIES"`
+		CookieSecure    bool          `yaml:"cookieSecure" env:"AUTH_COOKIE_SECURE"`
+		CookieSameSite  string        `yaml:"cookieSameSite" env:"AUTH_COOKIE_SAME_SITE"`
+	} `yaml:"auth"`
+	RateLimit struct {
+		Enabled        bool         `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+		Store          string       `yaml:"store" env:"RATE_LIMIT_STORE"`
+		TrustedProxies []string     `yaml:"trustedProxies" env:"RATE_LIMIT_TRUSTED_PROXIES"`
+		Policies       []RatePolicy `yaml:"policies" env:"RATE_LIMIT_POLICIES"`
+	} `yaml:"rateLimit"`
+	Dialogs struct {
+		VirtualNodes int     `yaml:"vnodes" env:"DIALOGS_VNODES"`
+		Shards       []Shard `yaml:"shards" env:"DIALOGS_SHARDS"`
+	} `yaml:"dialogs"`
+	Counters struct {
+		RelayInterval     time.Duration `yaml:"relayInterval" env:"COUNTERS_RELAY_INTERVAL"`
+		ReconcileInterval time.Duration `yaml:"reconcileInterval" env:"COUNTERS_RECONCILE_INTERVAL"`
+	} `yaml:"counters"`
+	Presence struct {
+		OnlineWindow  time.Duration `yaml:"onlineWindow" env:"PRESENCE_ONLINE_WINDOW"`
+		TouchInterval time.Duration `yaml:"touchInterval" env:"PRESENCE_TOUCH_INTERVAL"`
+	} `yaml:"presence"`
+	GraphQL struct {
+		MaxDepth      int `yaml:"maxDepth" env:"GRAPHQL_MAX_DEPTH"`
+		MaxComplexity int `yaml:"maxComplexity" env:"GRAPHQL_MAX_COMPLEXITY"`
+	} `yaml:"graphql"`
+	Log struct {
+		Level  string `yaml:"level" env:"LOG_LEVEL"`
+		Format string `yaml:"format" env:"LOG_FORMAT"`
+	} `yaml:"log"`
+	Tracing struct {
+		Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+		Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+		ServiceName string  `yaml:"serviceName" env:"TRACING_SERVICE_NAME"`
+		SampleRatio float64 `yaml:"sampleRatio" env:"TRACING_SAMPLE_RATIO"`
+	} `yaml:"tracing"`
+
+	// Command line only
+	File        string `yaml:"-"`
+	PrintConfig bool   `yaml:"-"`
+}
+
+type Shard struct {
+	Name      string `yaml:"name"`
+	Host      string `yaml:"host"`
+	Database  string `yaml:"database"`
+	Dedicated bool   `yaml:"dedicated"`
 }
 
 /**
-Init configuration
+Limit of requests to routes, a key gets limit requests
+per period and may spend them in a burst. Routes are
+templates of the router, a trailing * matches any
+suffix, no routes or methods match every one
 */
-func InitConfig() *Config {
-	cfg := new(Config)
-	readConfigFile(cfg)
-	readEnv(cfg)
-	log.Printf("%+v", cfg)
-	return cfg
+type RatePolicy struct {
+	Name    string        `yaml:"name"`
+	Routes  []string      `yaml:"routes"`
+	Methods []string      `yaml:"methods"`
+	Key     string        `yaml:"key"`
+	Limit   int           `yaml:"limit"`
+	Period  time.Duration `yaml:"period"`
 }
 
 /**
-Read configuration file for
-application settings
+Connection pool and DSN parameters of a database host.
+Options of database apply to every host and shard,
+perHost sections override some of them by host
 */
-func readConfigFile(cfg *Config) {
-	f, err := os.Open("config.yaml")
-	if err != nil {
-		processError(err)
+type HostOptions struct {
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxIdleTime time.Duration `yaml:"connMaxIdleTime" env:"DB_CONN_MAX_IDLE_TIME"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	Timeout         time.Duration `yaml:"timeout" env:"DB_TIMEOUT"`
+	ReadTimeout     time.Duration `yaml:"readTimeout" env:"DB_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"writeTimeout" env:"DB_WRITE_TIMEOUT"`
+	ParseTime       bool          `yaml:"parseTime" env:"DB_PARSE_TIME"`
+	Charset         string        `yaml:"charset" env:"DB_CHARSET"`
+	TLS             string        `yaml:"tls" env:"DB_TLS"`
+	TLSCa           string        `yaml:"tlsCa" env:"DB_TLS_CA"`
+	TLSCert         string        `yaml:"tlsCert" env:"DB_TLS_CERT"`
+	TLSKey          string        `yaml:"tlsKey" env:"DB_TLS_KEY"`
+}
+
+/**
+Init configuration from defaults, file, environment
+and flags of the set. Commands may register their
+own flags in the set before
+*/
+func InitConfig(flags *flag.FlagSet, args []string) (*Config, error) {
+	cfg := new(Config)
+	setDefaults(cfg)
+
+	flags.StringVar(&cfg.File, "config", "", fmt.Sprintf("Path of config file, %s by default (env CONFIG_FILE)", defaultConfigFile))
+	flags.BoolVar(&cfg.PrintConfig, "print-config", false, "Print effective configuration with secrets masked and exit")
+	registerFlags(flags, cfg)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
 	}
-	defer f.Close()
 
-	decoder := yaml.NewDecoder(f)
-	err = decoder.Decode(&cfg)
-	if err != nil {
-		processError(err)
+	if err := readConfigFile(cfg); err != nil {
+		return nil, err
+	}
+	if err := readEnv(cfg); err != nil {
+		return nil, err
 	}
+	if err := readFlags(flags, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
 /**
-Read configuration enviroments
+Default settings which are used
+when they are not configured
 */
-func readEnv(cfg *Config) {
-	port := os.Getenv("PORT")
-	dbUsername := os.Getenv("DB_USERNAME")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbName := os.Getenv("DB_NAME")
+func setDefaults(cfg *Config) {
+	cfg.Server.Port = "8080"
+	cfg.Server.GrpcPort = "9090"
+	cfg.Server.ReadTimeout = 15 * time.Second
+	cfg.Server.ReadHeaderTimeout = 5 * time.Second
+	cfg.Server.WriteTimeout = 30 * time.Second
+	cfg.Server.IdleTimeout = 2 * time.Minute
+	cfg.Server.ShutdownTimeout = 30 * time.Second
+	cfg.Server.OpenAPI = "./openapi.yaml"
+	cfg.Server.TLS.ReloadInterval = 10 * time.Second
+	cfg.Database.ReplicaLagBudget = 10 * time.Second
+	cfg.Database.ConnectRetry = time.Minute
+	cfg.Database.MaxOpenConns = 25
+	cfg.Database.MaxIdleConns = 25
+	cfg.Database.ConnMaxLifetime = 5 * time.Minute
+	cfg.Database.Timeout = 5 * time.Second
+	cfg.Database.ReadTimeout = 30 * time.Second
+	cfg.Database.WriteTimeout = 30 * time.Second
+	cfg.Database.Migrations = "./migrations"
+	cfg.Database.AutoMigrate = true
+	cfg.Cors.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	cfg.Cors.AllowedHeaders = []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "If-Modified-Since", "traceparent", "tracestate"}
+	cfg.Cors.ExposedHeaders = []string{"Authorization", "Location", "Deprecation", "Sunset", "Link", "X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After"}
+	cfg.Cors.MaxAge = 10 * time.Minute
+	cfg.Headers.ContentSecurityPolicy = defaultContentSecurityPolicy
+	cfg.Headers.HstsMaxAge = 180 * 24 * time.Hour
+	cfg.Headers.FrameOptions = "DENY"
+	cfg.Headers.ReferrerPolicy = "strict-origin-when-cross-origin"
+	cfg.Auth.AccessTokenTtl = 24 * time.Hour
+	cfg.Auth.RefreshTokenTtl = 30 * 24 * time.Hour
+	cfg.Auth.CookieSecure = true
+	cfg.Auth.CookieSameSite = "strict"
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Store = "memory"
+	cfg.RateLimit.Policies = []RatePolicy{
+		{Name: "auth", Routes: []string{"/api/v1/singin", "/api/v1/singup", "/api/v2/sessions", "/api/v2/sessions/refresh", "/api/v2/users"}, Methods: []string{"POST"}, Key: "ip", Limit: 10, Period: time.Minute},
+		{Name: "logins", Routes: []string{"/api/v1/singup/{login}", "/api/v2/logins/{login}"}, Key: "ip", Limit: 20, Period: time.Minute},
+		{Name: "search", Routes: []string{"/api/v1/friends/full", "/api/v2/search/users"}, Key: "user", Limit: 30, Period: time.Minute},
+		{Name: "api", Routes: []string{"/api/*", "/graphql"}, Key: "user", Limit: 300, Period: time.Minute},
+	}
+	cfg.Dialogs.VirtualNodes = defaultVirtualNodes
+	cfg.Counters.RelayInterval = time.Second
+	cfg.Presence.OnlineWindow = 2 * time.Minute
+	cfg.Presence.TouchInterval = 30 * time.Second
+	cfg.GraphQL.MaxDepth = 8
+	cfg.GraphQL.MaxComplexity = 1000
+	cfg.Log.Level = "info"
+	cfg.Log.Format = "text"
+	cfg.Tracing.Exporter = "none"
+	cfg.Tracing.ServiceName = "social-network"
+	cfg.Tracing.SampleRatio = 1
+}
 
-	if port != "" {
-		cfg.Server.Port = port
+/**
+Read configuration file for application settings.
+Default file is optional, the one given explicitly is not
+*/
+func readConfigFile(cfg *Config) error {
+	path := cfg.File
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
 	}
-	if dbUsername != "" {
-		cfg.Database.Username = dbUsername
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigFile
 	}
-	if dbPassword != "" {
-		cfg.Database.Password = dbPassword
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
 	}
-	if dbHost != "" {
-		cfg.Database.Hosts = append(cfg.Database.Hosts[:0], fmt.Sprintf("%s:%s",dbHost, dbPort))
+	defer f.Close()
+	cfg.File = path
+
+	decoder := yaml.NewDecoder(f)
+	decoder.SetStrict(true)
+	err = decoder.Decode(cfg)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("cannot parse config file %s: %v", path, err)
 	}
-	if dbName != "" {
-		cfg.Database.Name = dbName
+	return nil
+}
+
+/* Server is served over HTTPS */
+func (c *Config) TLSEnabled() bool {
+	return c.Server.TLS.CertFile != ""
+}
+
+/* Host receiving writes and migrations, the first one by default */
+func (c *Config) PrimaryHost() string {
+	if c.Database.Primary != "" || len(c.Database.Hosts) == 0 {
+		return c.Database.Primary
 	}
+	return c.Database.Hosts[0]
 }
 
 /**
-Will throw error if cannot
-read configuration file
+Options of database host, per host settings
+override the ones of database section
 */
-func processError(err error) {
-	fmt.Println(err)
-	os.Exit(2)
+func (c *Config) OptionsOf(host string) (HostOptions, error) {
+	options := c.Database.HostOptions
+	override, ok := c.Database.PerHost[host]
+	if !ok {
+		return options, nil
+	}
+	raw, err := yaml.Marshal(override)
+	if err == nil {
+		err = yaml.UnmarshalStrict(raw, &options)
+	}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		err = errors.New(strings.Join(typeErr.Errors, ", "))
+	}
+	return options, err
+}
+
+/* Print effective configuration as YAML, secrets are masked */
+func Print(w io.Writer, cfg *Config) error {
+	masked := *cfg
+	maskSecrets(&masked)
+	if masked.File != "" {
+		if _, err := fmt.Fprintf(w, "# Loaded from %s\n", masked.File); err != nil {
+			return err
+		}
+	}
+	return yaml.NewEncoder(w).Encode(&masked)
 }
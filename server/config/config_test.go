@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const minimalFile = `
+database:
+  user: root
+  pass: secret
+  name: social_network
+  hosts: [mysql-db:3306, mysql-replica:3306]
+`
+
+func TestLaterLayersOverrideEarlierOnes(t *testing.T) {
+	path := writeFile(t, minimalFile+"server:\n  port: \"7000\"\n  readTimeout: 3s\nlog:\n  level: debug\n")
+	setEnv(t, map[string]string{"PORT": "7001", "LOG_LEVEL": "warn"})
+
+	cfg := mustInit(t, "-config", path, "--server.port", "7002")
+	if cfg.Server.Port != "7002" {
+		t.Errorf("port = %s, flag must win over env and file", cfg.Server.Port)
+	}
+	if cfg.Log.Level != "warn" {
+		t.Errorf("log level = %s, env must win over file", cfg.Log.Level)
+	}
+	if cfg.Server.ReadTimeout != 3*time.Second {
+		t.Errorf("read timeout = %s, file must win over default", cfg.Server.ReadTimeout)
+	}
+	if cfg.Server.WriteTimeout != 30*time.Second {
+		t.Errorf("write timeout = %s, default must stay when nothing sets it", cfg.Server.WriteTimeout)
+	}
+}
+
+func TestEmptyEnvDoesNotClearFile(t *testing.T) {
+	path := writeFile(t, minimalFile)
+	setEnv(t, map[string]string{"DB_NAME": ""})
+	if cfg := mustInit(t, "-config", path); cfg.Database.Name != "social_network" {
+		t.Errorf("database name = %q, empty env must be ignored", cfg.Database.Name)
+	}
+}
+
+func TestHostsOfEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"list", map[string]string{"DB_HOSTS": " a:3306, b:3307,"}, []string{"a:3306", "b:3307"}},
+		{"single host with default port", map[string]string{"DB_HOST": "db"}, []string{"db:3306"}},
+		{"single host replaces list", map[string]string{"DB_HOST": "db", "DB_PORT": "3307"}, []string{"db:3307"}},
+		{"port of every host", map[string]string{"DB_PORT": "3307"}, []string{"mysql-db:3307", "mysql-replica:3307"}},
+		{"IPv6 host", map[string]string{"DB_HOST": "::1"}, []string{"[::1]:3306"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, test.env)
+			cfg := mustInit(t, "-config", writeFile(t, minimalFile))
+			if !reflect.DeepEqual(cfg.Database.Hosts, test.want) {
+				t.Errorf("hosts = %q, want %q", cfg.Database.Hosts, test.want)
+			}
+		})
+	}
+}
+
+func TestSectionsOfEnvAreYaml(t *testing.T) {
+	setEnv(t, map[string]string{"DIALOGS_SHARDS": "[{name: shard-1, host: 'db-1:3306'}, {name: hot, host: 'db-2:3306', dedicated: true}]"})
+	cfg := mustInit(t, "-config", writeFile(t, minimalFile))
+	want := []Shard{{Name: "shard-1", Host: "db-1:3306"}, {Name: "hot", Host: "db-2:3306", Dedicated: true}}
+	if !reflect.DeepEqual(cfg.Dialogs.Shards, want) {
+		t.Errorf("shards = %+v, want %+v", cfg.Dialogs.Shards, want)
+	}
+}
+
+func TestFlagWithItsOwnName(t *testing.T) {
+	cfg := mustInit(t, "-config", writeFile(t, minimalFile), "--migration.files", "/migrations")
+	if cfg.Database.Migrations != "/migrations" {
+		t.Errorf("migrations = %q, want the --migration.files flag kept from before", cfg.Database.Migrations)
+	}
+}
+
+func TestDefaultFileIsOptional(t *testing.T) {
+	setEnv(t, map[string]string{"DB_USERNAME": "root", "DB_NAME": "social_network", "DB_HOST": "db"})
+	// Package directory has no config.yaml
+	if _, err := InitConfig(flag.NewFlagSet("test", flag.ContinueOnError), nil); err != nil {
+		t.Errorf("InitConfig() without config file error = %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := InitConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", missing}); err == nil {
+		t.Error("InitConfig() with missing explicit file must fail")
+	}
+}
+
+func TestErrorsNameTheirSource(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{name: "misspelled setting of file", file: "server:\n  prot: \"7000\"\n", want: "field prot not found"},
+		{name: "duration of env", env: map[string]string{"SERVER_READ_TIMEOUT": "15"}, want: "env SERVER_READ_TIMEOUT"},
+		{name: "number of flag", args: []string{"--database.maxOpenConns", "many"}, want: "flag --database.maxOpenConns"},
+		{name: "section of env", env: map[string]string{"DIALOGS_SHARDS": "[{name: a, hots: b}]"}, want: "env DIALOGS_SHARDS"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, test.env)
+			args := append([]string{"-config", writeFile(t, minimalFile+test.file)}, test.args...)
+			_, err := InitConfig(flag.NewFlagSet("test", flag.ContinueOnError), args)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("InitConfig() error = %v, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := new(Config)
+	setDefaults(cfg)
+	cfg.Server.Port = "80a"
+	cfg.Server.ShutdownTimeout = 0
+	cfg.Database.Hosts = []string{"db:3306", "db", "db:3306"}
+	cfg.Dialogs.Shards = []Shard{{Name: "hot", Host: "db-hot:3306", Dedicated: true}}
+	cfg.Tracing.SampleRatio = 1.5
+
+	err, ok := cfg.Validate().(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate() error = %v, want ValidationError", err)
+	}
+	want := []string{
+		"server.port", "server.shutdownTimeout", "database.user", "database.name",
+		"database.hosts[1]", "database.hosts[2]", "dialogs.shards", "tracing.sampleRatio",
+	}
+	paths := make([]string, 0, len(err.Problems))
+	for _, problem := range err.Problems {
+		paths = append(paths, strings.SplitN(problem, ":", 2)[0])
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("problems:\n  %s\nwant problems of %q", strings.Join(err.Problems, "\n  "), want)
+	}
+}
+
+func TestPrintMasksSecrets(t *testing.T) {
+	cfg := mustInit(t, "-config", writeFile(t, minimalFile))
+	var out bytes.Buffer
+	if err := Print(&out, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "secret") || !strings.Contains(out.String(), maskedSecret) {
+		t.Errorf("printed config shows the password:\n%s", out.String())
+	}
+	if cfg.Database.Password != "secret" {
+		t.Errorf("printing changed the password of config to %q", cfg.Database.Password)
+	}
+}
+
+func mustInit(t *testing.T, args ...string) *Config {
+	cfg, err := InitConfig(flag.NewFlagSet("test", flag.ContinueOnError), args)
+	if err != nil {
+		t.Fatalf("InitConfig() error = %v", err)
+	}
+	return cfg
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/* Set variables for the test, previous values are restored after it */
+func setEnv(t *testing.T, env map[string]string) {
+	for name, value := range env {
+		previous, existed := os.LookupEnv(name)
+		os.Setenv(name, value)
+		name := name
+		t.Cleanup(func() {
+			if existed {
+				os.Setenv(name, previous)
+			} else {
+				os.Unsetenv(name)
+			}
+		})
+	}
+}
+
+func TestOptionsOfHost(t *testing.T) {
+	path := writeFile(t, minimalFile+`
+  maxOpenConns: 50
+  tls: "true"
+  perHost:
+    mysql-replica:3306:
+      maxOpenConns: 10
+      readTimeout: 1m
+`)
+	cfg := mustInit(t, "-config", path)
+
+	primary, err := cfg.OptionsOf("mysql-db:3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.MaxOpenConns != 50 || primary.ReadTimeout != 30*time.Second {
+		t.Errorf("options of host without perHost = %+v, want options of database", primary)
+	}
+	replica, err := cfg.OptionsOf("mysql-replica:3306")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replica.MaxOpenConns != 10 || replica.ReadTimeout != time.Minute {
+		t.Errorf("options of replica = %+v, want perHost to override", replica)
+	}
+	if replica.TLS != "true" || replica.MaxIdleConns != 25 {
+		t.Errorf("options of replica = %+v, want options missing in perHost kept", replica)
+	}
+}
+
+func TestPerHostProblems(t *testing.T) {
+	setEnv(t, map[string]string{"DB_PER_HOST": "{mysql-db:3306: {maxOpenConn: 5}, other:3306: {tls: sometimes}, mysql-replica:3306: {maxIdleConns: -1}}"})
+	_, err := InitConfig(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", writeFile(t, minimalFile)})
+	for _, want := range []string{
+		"field maxOpenConn not found",
+		"database.perHost[mysql-replica:3306].maxIdleConns",
+		"database.perHost[other:3306]: is not a host",
+		"database.perHost[other:3306].tls",
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("InitConfig() error = %v, want %q", err, want)
+		}
+	}
+}
@@ -1,19 +1,32 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
-	"flag"
-	"fmt"
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/mysql"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"log"
+	"errors"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
 	"time"
 )
 
 var dbs []*sql.DB
+var dbsByHost = make(map[string]*sql.DB)
 
+var primary *sql.DB
+var databaseName string
+var migrationDir string
+
+/* Settings of connected databases, migrations open their own connections */
+var connected *Config
+
+const (
+	minConnectBackoff = 500 * time.Millisecond
+	maxConnectBackoff = 10 * time.Second
+)
+
+/* Connection of the next host in turn, replicas included, for reads only */
 func DataBase() *sql.DB {
 	if dbs == nil || len(dbs) == 0 {
 		log.Fatalf("Database wasn't connected")
@@ -23,6 +36,23 @@ func DataBase() *sql.DB {
 	return db
 }
 
+/* Connections of all database hosts by host name */
+func DataBasesByHost() map[string]*sql.DB {
+	result := make(map[string]*sql.DB, len(dbsByHost))
+	for host, db := range dbsByHost {
+		result[host] = db
+	}
+	return result
+}
+
+/* Connection of the host receiving writes and migrations */
+func PrimaryDataBase() *sql.DB {
+	if primary == nil {
+		log.Fatalf("Database wasn't connected")
+	}
+	return primary
+}
+
 func CloseDataBase() {
 	if dbs != nil && len(dbs) > 0 {
 		for _, db := range dbs {
@@ -32,51 +62,154 @@ func CloseDataBase() {
 }
 
 func ConnectDataBase(cfg *Config) {
-	// Get configuration
-	username := cfg.Database.Username
-	password := cfg.Database.Password
-	hosts := cfg.Database.Hosts
+	connectHosts(cfg, cfg.Database.Hosts)
+}
+
+/* Connect the primary host only, e.g. for migrations */
+func ConnectPrimary(cfg *Config) {
+	connectHosts(cfg, []string{cfg.PrimaryHost()})
+}
+
+func connectHosts(cfg *Config, hosts []string) {
 	database := cfg.Database.Name
-	migrationDir := flag.String("migration.files", "./migrations",
-		"Directory where the migration files are located?")
-	flag.Parse()
+	databaseName = database
+	connected = cfg
+	migrationDir = cfg.Database.Migrations
 
 	for _, host := range hosts {
 		// Connecting database
-		url := fmt.Sprintf("%s:%s@tcp(%s)/%s",username, password, host, database)
-		log.Printf("DATABASE_URL %+v", url)
-		var err error
-		db, err := sql.Open("mysql", url)
-		if err != nil {
-			log.Fatalf("Cannot connect to the database... %v", err)
-		}
-		db.SetMaxOpenConns(25)
-		db.SetMaxIdleConns(25)
-		db.SetConnMaxLifetime(5 * time.Minute)
-		if err := db.Ping(); err != nil {
-			log.Fatalf("Cannot ping to the database... %v", err)
+		log.WithFields(log.Fields{"host": host, "database": database}).Info("Connecting database")
+		db := openDataBase(host, database, cfg)
+		if host == cfg.PrimaryHost() {
+			primary = db
 		}
 
-		// Run migration
-		driver, err := mysql.WithInstance(db, &mysql.Config{})
+		dbs = append(dbs, db)
+		dbsByHost[host] = db
+	}
+}
+
+/**
+Open connection pool to the database with
+options of host and wait until it is reachable
+*/
+func openDataBase(host string, database string, cfg *Config) *sql.DB {
+	options, err := cfg.OptionsOf(host)
+	if err != nil {
+		log.Fatalf("Cannot read options of %s... %v", host, err)
+	}
+	dsn, err := dsnOf(host, database, cfg, options)
+	if err != nil {
+		log.Fatalf("Cannot configure TLS of %s... %v", host, err)
+	}
+
+	connector, err := mysqlDriver.NewConnector(dsn)
+	if err != nil {
+		log.Fatalf("Cannot connect to the database... %v", err)
+	}
+	db := sql.OpenDB(newTracedConnector(connector, host, database))
+	db.SetMaxOpenConns(options.MaxOpenConns)
+	db.SetMaxIdleConns(options.MaxIdleConns)
+	db.SetConnMaxIdleTime(options.ConnMaxIdleTime)
+	db.SetConnMaxLifetime(options.ConnMaxLifetime)
+	waitForDataBase(db, host, cfg.Database.ConnectRetry)
+	return db
+}
+
+/**
+Connection of migrations, separate from the pool of host.
+Files of migrations hold several statements, which
+are accepted by this connection only
+*/
+func openMigrationDataBase(host string, database string) (*sql.DB, error) {
+	options, err := connected.OptionsOf(host)
+	if err != nil {
+		return nil, err
+	}
+	dsn, err := dsnOf(host, database, connected, options)
+	if err != nil {
+		return nil, err
+	}
+	dsn.MultiStatements = true
+	connector, err := mysqlDriver.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(connector), nil
+}
+
+/* DSN of database on host with options of the host */
+func dsnOf(host string, database string, cfg *Config, options HostOptions) (*mysqlDriver.Config, error) {
+	var err error
+	dsn := mysqlDriver.NewConfig()
+	dsn.User = cfg.Database.Username
+	dsn.Passwd = cfg.Database.Password
+	dsn.Net = "tcp"
+	dsn.Addr = host
+	dsn.DBName = database
+	dsn.Timeout = options.Timeout
+	dsn.ReadTimeout = options.ReadTimeout
+	dsn.WriteTimeout = options.WriteTimeout
+	dsn.ParseTime = options.ParseTime
+	if options.Charset != "" {
+		dsn.Params = map[string]string{"charset": options.Charset}
+	}
+	dsn.TLSConfig, err = tlsConfigOf(host, options)
+	return dsn, err
+}
+
+/**
+TLS parameter of DSN. Certificate authority and client
+certificate are registered with the driver by host,
+the other modes are understood by the driver itself
+*/
+func tlsConfigOf(host string, options HostOptions) (string, error) {
+	if options.TLSCa == "" && options.TLSCert == "" {
+		return options.TLS, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: options.TLS == "skip-verify"}
+	if options.TLSCa != "" {
+		pem, err := ioutil.ReadFile(options.TLSCa)
 		if err != nil {
-			log.Fatalf("Cannot start sql migration... %v", err)
+			return "", err
 		}
-
-		m, err := migrate.NewWithDatabaseInstance(
-			fmt.Sprintf("file://%s", *migrationDir),
-			database,
-			driver,
-		)
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return "", errors.New("no certificates in " + options.TLSCa)
+		}
+	}
+	if options.TLSCert != "" {
+		certificate, err := tls.LoadX509KeyPair(options.TLSCert, options.TLSKey)
 		if err != nil {
-			log.Fatalf("Migration failed... %v", err)
+			return "", err
 		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	name := "host-" + host
+	return name, mysqlDriver.RegisterTLSConfig(name, config)
+}
 
-		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-			log.Fatalf("An error occurred while syncing the database.. %v", err)
+/**
+Ping database until it answers, e.g. while MySQL
+is starting, waiting longer after every failure
+*/
+func waitForDataBase(db *sql.DB, host string, retry time.Duration) {
+	deadline := time.Now().Add(retry)
+	backoff := minConnectBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.Ping()
+		if err == nil {
+			return
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			log.WithField("host", host).Fatalf("Cannot ping to the database after %d attempts... %v", attempt, err)
+		}
+		log.WithFields(log.Fields{"host": host, "attempt": attempt, "retryIn": backoff.String()}).
+			WithError(err).Warn("Database is not reachable")
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
 		}
-		log.Println("Database migrated")
-
-		dbs = append(dbs, db)
 	}
 }
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDsnOfHost(t *testing.T) {
+	cfg := &Config{}
+	cfg.Database.Username = "root"
+	cfg.Database.Password = "p@ss:word/"
+	options := HostOptions{Timeout: time.Second, ParseTime: true, Charset: "utf8mb4", TLS: "skip-verify"}
+
+	dsn, err := dsnOf("db:3306", "social_network", cfg, options)
+	want := "root:p@ss:word/@tcp(db:3306)/social_network?parseTime=true&timeout=1s&tls=skip-verify&charset=utf8mb4"
+	if err != nil || dsn.FormatDSN() != want {
+		t.Errorf("dsnOf() = %s, %v, want %s", dsn.FormatDSN(), err, want)
+	}
+	dsn, err = dsnOf("db:3306", "social_network", cfg, HostOptions{})
+	if err != nil || dsn.FormatDSN() != "root:p@ss:word/@tcp(db:3306)/social_network" {
+		t.Errorf("dsnOf() without options = %s, %v", dsn.FormatDSN(), err)
+	}
+}
+
+func TestTlsConfigOfFiles(t *testing.T) {
+	empty := filepath.Join(t.TempDir(), "ca.pem")
+	if err := ioutil.WriteFile(empty, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := tlsConfigOf("db:3306", HostOptions{TLS: "true", TLSCa: empty})
+	if err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Errorf("tlsConfigOf() of file without certificates error = %v", err)
+	}
+	_, err = tlsConfigOf("db:3306", HostOptions{TLS: "true", TLSCert: filepath.Join(t.TempDir(), "missing.pem")})
+	if err == nil {
+		t.Error("tlsConfigOf() of missing client certificate must fail")
+	}
+}
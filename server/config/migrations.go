@@ -0,0 +1,217 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/mysql"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Migrations of schema. They are applied to the primary host
+ * and to every dialog shard, replicas receive them by replication
+ */
+
+const MainTarget = "main"
+
+/* Error number of MySQL for missing table */
+const errNoSuchTable = 1146
+
+type SchemaStatus struct {
+	Target  string `json:"target"`
+	Version uint64 `json:"version"`
+	Latest  uint64 `json:"latest"`
+	Dirty   bool   `json:"dirty"`
+}
+
+/* Schema is dirty or misses migrations */
+func (s *SchemaStatus) Err() error {
+	if s.Dirty {
+		return fmt.Errorf("migration %d is dirty", s.Version)
+	}
+	if s.Version < s.Latest {
+		return fmt.Errorf("migration %d is applied, %d is expected", s.Version, s.Latest)
+	}
+	return nil
+}
+
+/* Main database and names of dialog shards */
+func MigrationTargets() []string {
+	targets := []string{MainTarget}
+	if ShardsConfigured() {
+		targets = append(targets, ShardNames()...)
+	}
+	return targets
+}
+
+/* Directory of migrations of main database or shards */
+func MigrationDirOf(target string) string {
+	if target == MainTarget {
+		return migrationDir
+	}
+	return filepath.Join(migrationDir, "shards")
+}
+
+/**
+Migration of main database or dialog shard by name.
+It has its own connection, which is closed with it
+*/
+func NewMigration(target string) (*migrate.Migrate, error) {
+	host, database, err := migrationHost(target)
+	if err != nil {
+		return nil, err
+	}
+	db, err := openMigrationDataBase(host, database)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := mysql.WithInstance(db, &mysql.Config{})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithDatabaseInstance(fmt.Sprintf("file://%s", MigrationDirOf(target)), database, driver)
+	if err != nil {
+		driver.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+/* Host and database receiving migrations of target */
+func migrationHost(target string) (string, string, error) {
+	if target == MainTarget {
+		return connected.PrimaryHost(), databaseName, nil
+	}
+	host, ok := shardHosts[target]
+	if !ok {
+		return "", "", fmt.Errorf("unknown migration target %s, expected %s or a dialog shard", target, MainTarget)
+	}
+	return host, shardDatabases[target], nil
+}
+
+func migrationDataBase(target string) (*sql.DB, string, error) {
+	if target == MainTarget {
+		return PrimaryDataBase(), databaseName, nil
+	}
+	db, ok := shards[target]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown migration target %s, expected %s or a dialog shard", target, MainTarget)
+	}
+	return db, shardDatabases[target], nil
+}
+
+/* Apply new migrations to main database and every shard */
+func MigrateUp() error {
+	for _, target := range MigrationTargets() {
+		m, err := NewMigration(target)
+		if err != nil {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+		err = m.Up()
+		CloseMigration(m)
+		if err != nil && err != migrate.ErrNoChange {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+		log.WithField("target", target).Info("Schema migrated")
+	}
+	return nil
+}
+
+/* Close source and connection of migration */
+func CloseMigration(m *migrate.Migrate) {
+	sourceErr, dbErr := m.Close()
+	if sourceErr != nil || dbErr != nil {
+		log.Warnf("Cannot close migration... %v %v", sourceErr, dbErr)
+	}
+}
+
+/* Applied and latest migrations of main database and every shard */
+func SchemaStatuses(ctx context.Context) ([]*SchemaStatus, error) {
+	statuses := make([]*SchemaStatus, 0)
+	for _, target := range MigrationTargets() {
+		status, err := TargetSchemaStatus(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+/* Applied and latest migrations of main database or dialog shard by name */
+func TargetSchemaStatus(ctx context.Context, target string) (*SchemaStatus, error) {
+	db, _, err := migrationDataBase(target)
+	if err != nil {
+		return nil, err
+	}
+	status, err := SchemaStatusOf(ctx, db, MigrationDirOf(target))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", target, err)
+	}
+	status.Target = target
+	return status, nil
+}
+
+/* Refuse to work with schema which is behind migrations */
+func CheckSchema(ctx context.Context) error {
+	statuses, err := SchemaStatuses(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if err = status.Err(); err != nil {
+			return fmt.Errorf("%s: %v", status.Target, err)
+		}
+	}
+	return nil
+}
+
+/* Applied migration of database and the latest one in directory */
+func SchemaStatusOf(ctx context.Context, db *sql.DB, dir string) (*SchemaStatus, error) {
+	status := new(SchemaStatus)
+	latest, err := latestMigration(dir)
+	if err != nil {
+		return nil, err
+	}
+	status.Latest = latest
+
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&status.Version, &status.Dirty)
+	if mysqlErr, ok := err.(*mysqlDriver.MySQLError); ok && mysqlErr.Number == errNoSuchTable {
+		return status, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return status, nil
+}
+
+/* Version of the newest migration in directory */
+func latestMigration(dir string) (uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	var latest uint64
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".up.sql") {
+			continue
+		}
+		version, err := strconv.ParseUint(strings.SplitN(file.Name(), "_", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLatestMigration(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"1_create_table_users.up.sql",
+		"1_create_table_users.down.sql",
+		"10_create_table_rate_limits.up.sql",
+		"9_create_table_posts.up.sql",
+		"11_create_table_later.down.sql",
+		"README.md",
+		"draft_add_index.up.sql",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "12_shards.up.sql"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := latestMigration(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != 10 {
+		t.Errorf("latestMigration() = %d, want 10 compared as number, not as text", latest)
+	}
+	if _, err = latestMigration(filepath.Join(dir, "missing")); err == nil {
+		t.Error("latestMigration() of missing directory must fail")
+	}
+}
+
+func TestSchemaStatusErr(t *testing.T) {
+	tests := []struct {
+		status SchemaStatus
+		want   string
+	}{
+		{SchemaStatus{Version: 8, Latest: 8}, ""},
+		{SchemaStatus{Version: 0, Latest: 8}, "migration 0 is applied, 8 is expected"},
+		{SchemaStatus{Version: 8, Latest: 8, Dirty: true}, "migration 8 is dirty"},
+		// Schema of a newer release still serves this one
+		{SchemaStatus{Version: 9, Latest: 8}, ""},
+	}
+	for _, test := range tests {
+		err := test.status.Err()
+		if (err == nil) != (test.want == "") || err != nil && err.Error() != test.want {
+			t.Errorf("%+v.Err() = %v, want %q", test.status, err, test.want)
+		}
+	}
+}
+
+/* Up migrations run on databases holding data, e.g. after a forced version, so they must not drop tables */
+func TestUpMigrationsKeepData(t *testing.T) {
+	for _, dir := range []string{"../migrations", "../migrations/shards"} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.up.sql"))
+		if err != nil || len(files) == 0 {
+			t.Fatalf("no migrations in %s: %v", dir, err)
+		}
+		for _, file := range files {
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(strings.ToUpper(string(content)), "DROP TABLE") {
+				t.Errorf("%s drops a table", file)
+			}
+		}
+	}
+}
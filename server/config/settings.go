@@ -0,0 +1,204 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Settings of Config found by reflection, so that env
+ * variables and flags cover every field of it
+ */
+
+const defaultDataBasePort = "3306"
+
+const maskedSecret = "******"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+type setting struct {
+	path   string
+	env    string
+	flag   string
+	secret bool
+	value  reflect.Value
+}
+
+/* Leaf settings of config, nested sections are walked */
+func settings(cfg *Config) []setting {
+	return walk(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func walk(value reflect.Value, prefix string) []setting {
+	result := make([]setting, 0)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := field.Tag.Get("yaml")
+		if name == ",inline" {
+			result = append(result, walk(value.Field(i), prefix)...)
+			continue
+		}
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		if field.Type.Kind() == reflect.Struct {
+			result = append(result, walk(value.Field(i), path+".")...)
+			continue
+		}
+		item := setting{
+			path:   path,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			secret: field.Tag.Get("secret") == "true",
+			value:  value.Field(i),
+		}
+		if item.flag == "" {
+			item.flag = path
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+/**
+Set value of setting from text. Lists of strings are
+comma separated, lists of sections are YAML
+*/
+func (s setting) set(text string) error {
+	var err error
+	switch {
+	case s.value.Type() == durationType:
+		var duration time.Duration
+		if duration, err = time.ParseDuration(text); err == nil {
+			s.value.SetInt(int64(duration))
+		}
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(text)
+	case s.value.Kind() == reflect.Bool:
+		var parsed bool
+		if parsed, err = strconv.ParseBool(text); err == nil {
+			s.value.SetBool(parsed)
+		}
+	case s.value.Kind() == reflect.Int:
+		var parsed int
+		if parsed, err = strconv.Atoi(text); err == nil {
+			s.value.SetInt(int64(parsed))
+		}
+	case s.value.Kind() == reflect.Float64:
+		var parsed float64
+		if parsed, err = strconv.ParseFloat(text, 64); err == nil {
+			s.value.SetFloat(parsed)
+		}
+	case s.value.Type() == reflect.TypeOf([]string{}):
+		items := make([]string, 0)
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		s.value.Set(reflect.ValueOf(items))
+	default:
+		err = yaml.UnmarshalStrict([]byte(text), s.value.Addr().Interface())
+	}
+	if err != nil {
+		return fmt.Errorf("cannot parse %q as %s", text, s.value.Type())
+	}
+	return nil
+}
+
+/**
+Read configuration enviroments. DB_HOST and DB_PORT
+describe the only host, DB_PORT alone changes port
+of configured hosts
+*/
+func readEnv(cfg *Config) error {
+	dbHost := os.Getenv("DB_HOST")
+	dbPort := os.Getenv("DB_PORT")
+	if dbHost != "" {
+		if dbPort == "" {
+			dbPort = defaultDataBasePort
+		}
+		cfg.Database.Hosts = []string{net.JoinHostPort(dbHost, dbPort)}
+	} else if dbPort != "" {
+		hosts := make([]string, len(cfg.Database.Hosts))
+		for i, address := range cfg.Database.Hosts {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				host = address
+			}
+			hosts[i] = net.JoinHostPort(host, dbPort)
+		}
+		cfg.Database.Hosts = hosts
+	}
+
+	for _, item := range settings(cfg) {
+		text, ok := os.LookupEnv(item.env)
+		if item.env == "" || !ok || text == "" {
+			continue
+		}
+		if err := item.set(text); err != nil {
+			return fmt.Errorf("env %s: %v", item.env, err)
+		}
+	}
+	return nil
+}
+
+/* Flag keeping text until flags are applied over the other layers */
+type settingFlag struct {
+	text string
+}
+
+func (f *settingFlag) String() string {
+	return f.text
+}
+
+func (f *settingFlag) Set(text string) error {
+	f.text = text
+	return nil
+}
+
+func registerFlags(flags *flag.FlagSet, cfg *Config) {
+	for _, item := range settings(cfg) {
+		usage := fmt.Sprintf("Setting %s", item.path)
+		if item.env != "" {
+			usage = fmt.Sprintf("%s (env %s)", usage, item.env)
+		}
+		flags.Var(new(settingFlag), item.flag, usage)
+	}
+}
+
+/* Apply flags given in command line */
+func readFlags(flags *flag.FlagSet, cfg *Config) error {
+	byFlag := make(map[string]setting)
+	for _, item := range settings(cfg) {
+		byFlag[item.flag] = item
+	}
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		item, ok := byFlag[f.Name]
+		value, isSetting := f.Value.(*settingFlag)
+		if err != nil || !ok || !isSetting {
+			return
+		}
+		if setErr := item.set(value.text); setErr != nil {
+			err = fmt.Errorf("flag --%s: %v", f.Name, setErr)
+		}
+	})
+	return err
+}
+
+func maskSecrets(cfg *Config) {
+	for _, item := range settings(cfg) {
+		if item.secret && item.value.String() != "" {
+			item.value.SetString(maskedSecret)
+		}
+	}
+}
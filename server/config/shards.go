@@ -0,0 +1,95 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultVirtualNodes = 100
+
+var shards = make(map[string]*sql.DB)
+var shardHosts = make(map[string]string)
+var shardDatabases = make(map[string]string)
+var shardNames []string
+var ringShardNames []string
+var virtualNodes = defaultVirtualNodes
+
+/* Names of configured dialog shards */
+func ShardNames() []string {
+	return shardNames
+}
+
+/**
+Names of shards placed on the hash ring.
+Dedicated shards only receive dialogs
+moved there explicitly
+*/
+func RingShardNames() []string {
+	return ringShardNames
+}
+
+/* Host of dialog shard by name */
+func ShardHost(name string) string {
+	return shardHosts[name]
+}
+
+/* Whether dialogs are stored in separate shards */
+func ShardsConfigured() bool {
+	return len(shards) > 0
+}
+
+/* Number of virtual nodes per shard on the hash ring */
+func ShardVirtualNodes() int {
+	return virtualNodes
+}
+
+/**
+Get connection of dialog shard by name.
+Without configured shards dialogs are
+stored in the primary of main database
+*/
+func ShardDataBase(name string) (*sql.DB, error) {
+	if len(shards) == 0 {
+		return PrimaryDataBase(), nil
+	}
+	db, ok := shards[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown dialog shard %s", name)
+	}
+	return db, nil
+}
+
+func CloseShards() {
+	for _, db := range shards {
+		db.Close()
+	}
+}
+
+func ConnectShards(cfg *Config) {
+	virtualNodes = cfg.Dialogs.VirtualNodes
+	if len(cfg.Dialogs.Shards) == 0 {
+		shardNames = []string{"default"}
+		ringShardNames = shardNames
+		return
+	}
+
+	for _, shard := range cfg.Dialogs.Shards {
+		database := shard.Database
+		if database == "" {
+			database = cfg.Database.Name
+		}
+
+		// Connecting shard
+		log.WithFields(log.Fields{"shard": shard.Name, "host": shard.Host, "database": database}).Info("Connecting shard")
+		db := openDataBase(shard.Host, database, cfg)
+
+		shards[shard.Name] = db
+		shardDatabases[shard.Name] = database
+		shardHosts[shard.Name] = shard.Host
+		shardNames = append(shardNames, shard.Name)
+		if !shard.Dedicated {
+			ringShardNames = append(ringShardNames, shard.Name)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"database/sql/driver"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/semconv"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Spans of SQL queries. Connections of every pool are wrapped,
+ * so that each query made within a traced request gets a span
+ * with the host the pool has chosen
+ */
+
+const instrumentationName = "social-network-study/config"
+
+type tracedConnector struct {
+	connector  driver.Connector
+	attributes []label.KeyValue
+}
+
+func newTracedConnector(connector driver.Connector, address string, database string) *tracedConnector {
+	attributes := []label.KeyValue{semconv.DBSystemMySQL, semconv.DBNameKey.String(database)}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	attributes = append(attributes, semconv.NetPeerNameKey.String(host))
+	if port, err := strconv.Atoi(port); err == nil {
+		attributes = append(attributes, semconv.NetPeerPortKey.Int(port))
+	}
+	return &tracedConnector{connector: connector, attributes: attributes}
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, connector: c}, nil
+}
+
+func (c *tracedConnector) Driver() driver.Driver {
+	return c.connector.Driver()
+}
+
+/**
+Record span of finished query. Queries outside of traces
+are skipped, as well as those the driver has to prepare first
+*/
+func (c *tracedConnector) trace(ctx context.Context, query string, start time.Time, err error) {
+	if err == driver.ErrSkip || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		return
+	}
+	operation := strings.ToUpper(strings.SplitN(strings.TrimSpace(query), " ", 2)[0])
+	attributes := append([]label.KeyValue{
+		semconv.DBOperationKey.String(operation),
+		semconv.DBStatementKey.String(query),
+	}, c.attributes...)
+	_, span := global.Tracer(instrumentationName).Start(ctx, "sql "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attributes...),
+	)
+	if err != nil {
+		span.RecordError(ctx, err, trace.WithErrorStatus(codes.Error))
+	}
+	span.End()
+}
+
+type tracedConn struct {
+	driver.Conn
+	connector *tracedConnector
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.connector.trace(ctx, query, start, err)
+	return rows, err
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.connector.trace(ctx, query, start, err)
+	return result, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, query: query, connector: c.connector}, nil
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type tracedStmt struct {
+	driver.Stmt
+	query     string
+	connector *tracedConnector
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	s.connector.trace(ctx, s.query, start, err)
+	return rows, err
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	s.connector.trace(ctx, s.query, start, err)
+	return result, err
+}
+
+func (s *tracedStmt) ColumnConverter(index int) driver.ValueConverter {
+	if converter, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return converter.ColumnConverter(index)
+	}
+	return driver.DefaultParameterConverter
+}
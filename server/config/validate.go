@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Problems of configuration, reported all at once */
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+type validation struct {
+	problems []string
+}
+
+func (v *validation) check(ok bool, path string, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validation) positive(path string, duration time.Duration) {
+	v.check(duration > 0, path, "must be a positive duration, got %s", duration)
+}
+
+func (v *validation) address(path string, address string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		v.check(false, path, "must be host:port, got %q", address)
+		return
+	}
+	number, err := strconv.Atoi(port)
+	v.check(host != "" && err == nil && number > 0 && number < 65536, path, "must be host:port, got %q", address)
+}
+
+func (v *validation) oneOf(path string, value string, allowed ...string) {
+	for _, item := range allowed {
+		if value == item {
+			return
+		}
+	}
+	v.check(false, path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (v *validation) hostOptions(path string, options HostOptions) {
+	v.check(options.MaxOpenConns >= 0, path+".maxOpenConns", "must not be negative, 0 is unlimited")
+	v.check(options.MaxIdleConns >= 0, path+".maxIdleConns", "must not be negative")
+	v.check(options.ConnMaxIdleTime >= 0, path+".connMaxIdleTime", "must not be negative, 0 is unlimited")
+	v.check(options.ConnMaxLifetime >= 0, path+".connMaxLifetime", "must not be negative, 0 is unlimited")
+	v.check(options.Timeout >= 0, path+".timeout", "must not be negative")
+	v.check(options.ReadTimeout >= 0, path+".readTimeout", "must not be negative")
+	v.check(options.WriteTimeout >= 0, path+".writeTimeout", "must not be negative")
+	v.oneOf(path+".tls", options.TLS, "", "false", "true", "skip-verify", "preferred")
+	custom := options.TLSCa != "" || options.TLSCert != ""
+	v.check(!custom || options.TLS == "true" || options.TLS == "skip-verify", path+".tls", "must be true or skip-verify with tlsCa or tlsCert, got %q", options.TLS)
+	v.check((options.TLSCert == "") == (options.TLSKey == ""), path+".tlsKey", "tlsCert and tlsKey must be set together")
+}
+
+/* Check that settings are usable before anything is started */
+func (c *Config) Validate() error {
+	v := new(validation)
+
+	port, err := strconv.Atoi(c.Server.Port)
+	v.check(err == nil && port > 0 && port < 65536, "server.port", "must be a number between 1 and 65535, got %q", c.Server.Port)
+	if c.Server.GrpcPort != "" {
+		grpcPort, err := strconv.Atoi(c.Server.GrpcPort)
+		v.check(err == nil && grpcPort > 0 && grpcPort < 65536, "server.grpcPort", "must be a number between 1 and 65535 or empty, got %q", c.Server.GrpcPort)
+		v.check(c.Server.GrpcPort != c.Server.Port, "server.grpcPort", "must differ from server.port")
+	}
+	v.check((c.Server.TLS.CertFile == "") == (c.Server.TLS.KeyFile == ""), "server.tls.keyFile", "certFile and keyFile must be set together")
+	v.check(c.Server.TLS.ReloadInterval >= 0, "server.tls.reloadInterval", "must not be negative, 0 disables reload")
+	if c.Server.TLS.RedirectPort != "" {
+		redirectPort, err := strconv.Atoi(c.Server.TLS.RedirectPort)
+		v.check(err == nil && redirectPort > 0 && redirectPort < 65536, "server.tls.redirectPort", "must be a number between 1 and 65535 or empty, got %q", c.Server.TLS.RedirectPort)
+		v.check(c.TLSEnabled(), "server.tls.redirectPort", "requires server.tls.certFile")
+		v.check(c.Server.TLS.RedirectPort != c.Server.Port && c.Server.TLS.RedirectPort != c.Server.GrpcPort, "server.tls.redirectPort", "must differ from server.port and server.grpcPort")
+	}
+	v.positive("server.readTimeout", c.Server.ReadTimeout)
+	v.positive("server.readHeaderTimeout", c.Server.ReadHeaderTimeout)
+	v.positive("server.writeTimeout", c.Server.WriteTimeout)
+	v.positive("server.idleTimeout", c.Server.IdleTimeout)
+	v.positive("server.shutdownTimeout", c.Server.ShutdownTimeout)
+	v.check(c.Server.OpenAPI != "", "server.openapi", "is required")
+	if c.Server.V1Sunset != "" {
+		_, err := time.Parse(DateFormat, c.Server.V1Sunset)
+		v.check(err == nil, "server.v1Sunset", "must be a date like 2027-06-30, got %q", c.Server.V1Sunset)
+	}
+
+	v.check(c.Database.Username != "", "database.user", "is required")
+	v.check(c.Database.Name != "", "database.name", "is required")
+	v.check(len(c.Database.Hosts) > 0, "database.hosts", "at least one host is required")
+	seenHosts := make(map[string]bool)
+	for i, host := range c.Database.Hosts {
+		path := fmt.Sprintf("database.hosts[%d]", i)
+		v.address(path, host)
+		v.check(!seenHosts[host], path, "duplicate host %q", host)
+		seenHosts[host] = true
+	}
+	v.check(c.Database.Primary == "" || seenHosts[c.Database.Primary], "database.primary", "must be one of hosts, got %q", c.Database.Primary)
+	v.positive("database.replicaLagBudget", c.Database.ReplicaLagBudget)
+	v.check(c.Database.ConnectRetry >= 0, "database.connectRetry", "must not be negative, 0 is a single attempt")
+	v.check(c.Database.Migrations != "", "database.migrations", "is required")
+	v.hostOptions("database", c.Database.HostOptions)
+
+	for i, origin := range c.Cors.AllowedOrigins {
+		path := fmt.Sprintf("cors.allowedOrigins[%d]", i)
+		v.check(origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://"), path, "must be * or scheme://host[:port], got %q", origin)
+		v.check(origin != "*" || !c.Cors.AllowCredentials, path, "* cannot be combined with cors.allowCredentials")
+	}
+	v.check(len(c.Cors.AllowedMethods) > 0, "cors.allowedMethods", "at least one method is required")
+	v.check(c.Cors.MaxAge >= 0 && c.Cors.MaxAge <= 10*time.Minute, "cors.maxAge", "must be between 0 and 10m")
+	v.check(c.Headers.HstsMaxAge >= 0, "headers.hstsMaxAge", "must not be negative, 0 disables HSTS")
+	v.oneOf("headers.frameOptions", c.Headers.FrameOptions, "", "DENY", "SAMEORIGIN")
+
+	v.positive("auth.accessTokenTtl", c.Auth.AccessTokenTtl)
+	v.positive("auth.refreshTokenTtl", c.Auth.RefreshTokenTtl)
+	v.check(c.Auth.RefreshTokenTtl >= c.Auth.AccessTokenTtl, "auth.refreshTokenTtl", "must not be shorter than auth.accessTokenTtl")
+	v.oneOf("auth.cookieSameSite", c.Auth.CookieSameSite, "strict", "lax", "none")
+	v.check(c.Auth.CookieSameSite != "none" || c.Auth.CookieSecure, "auth.cookieSameSite", "none requires auth.cookieSecure")
+
+	v.oneOf("rateLimit.store", c.RateLimit.Store, "memory", "database")
+	for i, proxy := range c.RateLimit.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		v.check(err == nil || net.ParseIP(proxy) != nil, fmt.Sprintf("rateLimit.trustedProxies[%d]", i), "must be an address or a network like 10.0.0.0/8, got %q", proxy)
+	}
+	seenPolicies := make(map[string]bool)
+	for i, policy := range c.RateLimit.Policies {
+		path := fmt.Sprintf("rateLimit.policies[%d]", i)
+		v.check(policy.Name != "", path+".name", "is required")
+		v.check(!seenPolicies[policy.Name], path+".name", "duplicate policy %q", policy.Name)
+		seenPolicies[policy.Name] = true
+		for j, route := range policy.Routes {
+			v.check(strings.HasPrefix(route, "/"), fmt.Sprintf("%s.routes[%d]", path, j), "must start with /, got %q", route)
+		}
+		v.oneOf(path+".key", policy.Key, "user", "ip")
+		v.check(policy.Limit > 0, path+".limit", "must be positive, got %d", policy.Limit)
+		v.positive(path+".period", policy.Period)
+	}
+
+	v.check(c.Dialogs.VirtualNodes > 0, "dialogs.vnodes", "must be positive, got %d", c.Dialogs.VirtualNodes)
+	seenShards := make(map[string]bool)
+	shardHosts := make(map[string]bool)
+	ringShards := 0
+	for i, shard := range c.Dialogs.Shards {
+		path := fmt.Sprintf("dialogs.shards[%d]", i)
+		v.check(shard.Name != "", path+".name", "is required")
+		v.check(!seenShards[shard.Name], path+".name", "duplicate shard %q", shard.Name)
+		seenShards[shard.Name] = true
+		v.address(path+".host", shard.Host)
+		shardHosts[shard.Host] = true
+		if !shard.Dedicated {
+			ringShards++
+		}
+	}
+	v.check(len(c.Dialogs.Shards) == 0 || ringShards > 0, "dialogs.shards", "at least one shard must not be dedicated")
+
+	perHost := make([]string, 0, len(c.Database.PerHost))
+	for host := range c.Database.PerHost {
+		perHost = append(perHost, host)
+	}
+	sort.Strings(perHost)
+	for _, host := range perHost {
+		path := fmt.Sprintf("database.perHost[%s]", host)
+		v.check(seenHosts[host] || shardHosts[host], path, "is not a host of database or shards")
+		options, err := c.OptionsOf(host)
+		if err != nil {
+			v.check(false, path, "%v", err)
+			continue
+		}
+		v.hostOptions(path, options)
+	}
+
+	v.positive("counters.relayInterval", c.Counters.RelayInterval)
+	v.check(c.Counters.ReconcileInterval >= 0, "counters.reconcileInterval", "must not be negative, 0 disables reconciliation")
+	v.positive("presence.onlineWindow", c.Presence.OnlineWindow)
+	v.positive("presence.touchInterval", c.Presence.TouchInterval)
+	v.check(c.GraphQL.MaxDepth > 0, "graphql.maxDepth", "must be positive")
+	v.check(c.GraphQL.MaxComplexity > 0, "graphql.maxComplexity", "must be positive")
+
+	_, err = log.ParseLevel(c.Log.Level)
+	v.check(err == nil, "log.level", "must be one of debug, info, warn, error, got %q", c.Log.Level)
+	v.oneOf("log.format", c.Log.Format, "text", "json")
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+	v.check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
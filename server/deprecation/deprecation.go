@@ -0,0 +1,36 @@
+package deprecation
+
+import (
+	"net/http"
+	"social-network-study/config"
+	"time"
+)
+
+/**
+ * Headers telling clients of API v1 that it is deprecated,
+ * where its successor is and when it is removed (RFC 8594)
+ */
+
+const successor = `</api/v2>; rel="successor-version"`
+
+var sunset string
+
+func Init(cfg *config.Config) {
+	if cfg.Server.V1Sunset == "" {
+		return
+	}
+	date, _ := time.Parse(config.DateFormat, cfg.Server.V1Sunset)
+	sunset = date.UTC().Format(http.TimeFormat)
+}
+
+/* Middleware marking responses of deprecated version */
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if sunset != "" {
+			w.Header().Set("Sunset", sunset)
+		}
+		w.Header().Add("Link", successor)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,108 @@
+package generate
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+/**
+ * Vocabulary of generated data. Cities are weighted
+ * by population so that big cities get more users
+ */
+
+var maleFirstNames = []string{"Alexander", "Alexey", "Andrey", "Anton", "Artem", "Boris", "Denis", "Dmitry", "Egor", "Evgeny",
+	"Fedor", "Georgy", "Gleb", "Igor", "Ilya", "Ivan", "Kirill", "Konstantin", "Leonid", "Makar", "Matvey", "Maxim",
+	"Mikhail", "Nikita", "Nikolay", "Oleg", "Pavel", "Roman", "Ruslan", "Semen", "Sergey", "Stepan", "Timofey",
+	"Vadim", "Valentin", "Viktor", "Vladimir", "Vladislav", "Yaroslav", "Yury"}
+
+var femaleFirstNames = []string{"Alena", "Alexandra", "Alina", "Alisa", "Anastasia", "Anna", "Arina", "Daria", "Ekaterina",
+	"Elena", "Elizaveta", "Eva", "Galina", "Irina", "Kristina", "Ksenia", "Larisa", "Lyudmila", "Margarita", "Maria",
+	"Marina", "Milana", "Nadezhda", "Natalia", "Nina", "Oksana", "Olga", "Polina", "Svetlana", "Sofia", "Tatiana",
+	"Ulyana", "Valeria", "Varvara", "Vasilisa", "Vera", "Veronika", "Viktoria", "Yana", "Yulia"}
+
+/* Male forms, female ones end with a */
+var lastNames = []string{"Alekseev", "Andreev", "Belov", "Bogdanov", "Borisov", "Volkov", "Vasiliev", "Vinogradov",
+	"Gavrilov", "Golubev", "Grigoriev", "Gusev", "Dmitriev", "Egorov", "Zaitsev", "Zakharov", "Ivanov", "Ilyin",
+	"Kiselev", "Komarov", "Kozlov", "Korolev", "Kuzmin", "Kuznetsov", "Lebedev", "Makarov", "Medvedev", "Mikhailov",
+	"Morozov", "Nikitin", "Nikolaev", "Novikov", "Orlov", "Pavlov", "Petrov", "Popov", "Romanov", "Semenov",
+	"Smirnov", "Sobolev", "Sokolov", "Solovyov", "Stepanov", "Tarasov", "Titov", "Fedorov", "Frolov", "Yakovlev"}
+
+type city struct {
+	name   string
+	weight float64
+}
+
+var cities = []city{{"Moscow", 12.6}, {"Saint Petersburg", 5.4}, {"Novosibirsk", 1.6}, {"Yekaterinburg", 1.5},
+	{"Kazan", 1.3}, {"Nizhny Novgorod", 1.25}, {"Chelyabinsk", 1.2}, {"Samara", 1.15}, {"Omsk", 1.15},
+	{"Rostov-on-Don", 1.1}, {"Ufa", 1.1}, {"Krasnoyarsk", 1.1}, {"Voronezh", 1.05}, {"Perm", 1.05},
+	{"Volgograd", 1.0}, {"Krasnodar", 0.95}, {"Tyumen", 0.8}, {"Irkutsk", 0.6}, {"Khabarovsk", 0.6},
+	{"Vladivostok", 0.6}, {"Yaroslavl", 0.6}, {"Tomsk", 0.57}, {"Kaliningrad", 0.49}, {"Sochi", 0.44}}
+
+var interests = []string{"music", "travel", "books", "football", "hockey", "cooking", "photography", "chess", "hiking",
+	"movies", "programming", "painting", "dancing", "yoga", "running", "cycling", "fishing", "gardening", "history",
+	"science", "theatre", "video games", "board games", "skiing", "swimming", "cars", "fashion", "languages",
+	"volunteering", "astronomy"}
+
+var words = []string{"today", "yesterday", "weekend", "morning", "evening", "city", "park", "friends", "family", "work",
+	"project", "coffee", "dinner", "book", "movie", "concert", "trip", "sea", "mountains", "weather", "rain", "sun",
+	"snow", "photo", "new", "old", "great", "amazing", "boring", "long", "short", "first", "last", "really", "finally",
+	"again", "never", "always", "maybe", "just", "went", "saw", "read", "made", "bought", "found", "met", "visited",
+	"started", "finished", "think", "love", "like", "want", "need", "remember", "forgot", "with", "without", "after",
+	"before", "about", "near", "home", "office", "train", "flight", "game", "match", "team", "music", "song", "dog",
+	"cat", "kids", "birthday", "holiday", "plans", "news", "idea", "question", "answer", "time", "day", "week", "year"}
+
+var replies = []string{"Hi!", "How are you?", "Fine, thanks", "See you tomorrow", "Sounds good", "Let me check",
+	"Thank you!", "Sure", "Call me later", "Where are you?", "On my way", "Happy birthday!", "Good night", "Ok",
+	"Did you see the news?", "What are your plans for the weekend?", "I'll be late", "Great idea", "Why not", "Miss you"}
+
+/* Cumulative weights for sampling items proportionally */
+type weighted struct {
+	cumulative []float64
+}
+
+func newWeighted(weights []float64) *weighted {
+	w := &weighted{cumulative: make([]float64, len(weights))}
+	total := 0.0
+	for i, weight := range weights {
+		total += weight
+		w.cumulative[i] = total
+	}
+	return w
+}
+
+/* Index of item chosen with probability proportional to its weight */
+func (w *weighted) pick(random *rand.Rand) int {
+	target := random.Float64() * w.cumulative[len(w.cumulative)-1]
+	i := sort.SearchFloat64s(w.cumulative, target)
+	if i == len(w.cumulative) {
+		i = len(w.cumulative) - 1
+	}
+	return i
+}
+
+var cityWeights = func() *weighted {
+	weights := make([]float64, len(cities))
+	for i, c := range cities {
+		weights[i] = c.weight
+	}
+	return newWeighted(weights)
+}()
+
+func pickString(random *rand.Rand, items []string) string {
+	return items[random.Intn(len(items))]
+}
+
+/* Sentences of random words, the first letter is capital */
+func sentences(random *rand.Rand, count int) string {
+	text := make([]string, count)
+	for i := range text {
+		sentence := make([]string, 4+random.Intn(10))
+		for j := range sentence {
+			sentence[j] = pickString(random, words)
+		}
+		line := strings.Join(sentence, " ")
+		text[i] = strings.ToUpper(line[:1]) + line[1:] + "."
+	}
+	return strings.Join(text, " ")
+}
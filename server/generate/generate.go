@@ -0,0 +1,443 @@
+package generate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"math"
+	"math/rand"
+	"social-network-study/config"
+	"social-network-study/model/counter"
+	"social-network-study/model/dialog"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+/**
+ * Bulk generator of test data: users, friendships, posts
+ * and messages. Rows are written by multi-row inserts, the
+ * same options and seed give the same data. Friendships
+ * follow the Chung-Lu model, so that degrees of users have
+ * a power-law distribution like in real social networks
+ */
+
+/* MySQL limit of placeholders in one statement */
+const maxPlaceholders = 65535
+
+const progressRows = 100000
+
+/* Format of dates of options */
+const DateLayout = "2006-01-02"
+
+/* Data ends with a fixed date by default, so that a seed gives the same data any day */
+var defaultUntil = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+type Options struct {
+	Users     int
+	Friends   float64 // average number of friends
+	Exponent  float64 // exponent of power-law degree distribution
+	Posts     float64 // average number of posts per user
+	Dialogs   float64 // average number of dialogs per user
+	Messages  float64 // average number of messages per dialog
+	Password  string
+	Prefix    string
+	BatchSize int
+	Seed      int64
+	Until     time.Time // generated timestamps are within the year before
+}
+
+/* Rows written by one phase of generation */
+type Phase struct {
+	Name     string        `json:"name"`
+	Rows     int64         `json:"rows"`
+	Duration time.Duration `json:"duration"`
+}
+
+type Report struct {
+	Phases []*Phase `json:"phases"`
+}
+
+type generator struct {
+	options Options
+	random  *rand.Rand
+	ids     []int
+	weights *weighted
+	report  *Report
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Users:     1000,
+		Friends:   20,
+		Exponent:  2.5,
+		Posts:     3,
+		Dialogs:   5,
+		Messages:  10,
+		Password:  "password",
+		Prefix:    "user",
+		BatchSize: 1000,
+		Seed:      1,
+		Until:     defaultUntil,
+	}
+}
+
+/* Options must describe some data and fit limits of MySQL */
+func (o Options) Validate() error {
+	switch {
+	case o.Users <= 0:
+		return errors.New("number of users must be positive")
+	case o.Friends < 0 || o.Posts < 0 || o.Dialogs < 0 || o.Messages < 0:
+		return errors.New("averages of friends, posts, dialogs and messages must not be negative")
+	case o.Exponent <= 2:
+		return errors.New("exponent of degree distribution must be greater than 2")
+	case o.BatchSize <= 0 || o.BatchSize*8 > maxPlaceholders:
+		return fmt.Errorf("batch size must be between 1 and %d", maxPlaceholders/8)
+	case o.Password == "" || o.Prefix == "":
+		return errors.New("password and prefix of logins are required")
+	}
+	return nil
+}
+
+/* Rows per second */
+func (p *Phase) Throughput() float64 {
+	if p.Duration <= 0 {
+		return 0
+	}
+	return float64(p.Rows) / p.Duration.Seconds()
+}
+
+/* Print phases as a table with the total in the end */
+func (r *Report) Print(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "PHASE\tROWS\tSECONDS\tROWS/S\t")
+	total := &Phase{Name: "total"}
+	for _, phase := range append(r.Phases, total) {
+		fmt.Fprintf(table, "%s\t%d\t%.1f\t%.0f\t\n", phase.Name, phase.Rows, phase.Duration.Seconds(), phase.Throughput())
+		total.Rows += phase.Rows
+		total.Duration += phase.Duration
+	}
+	return table.Flush()
+}
+
+/* Generate data into the primary database and dialog shards */
+func Run(ctx context.Context, options Options) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	g := &generator{
+		options: options,
+		random:  rand.New(rand.NewSource(options.Seed)),
+		report:  new(Report),
+	}
+	steps := []struct {
+		name string
+		run  func(ctx context.Context, phase *Phase) error
+	}{
+		{"users", g.users},
+		{"friends", g.friends},
+		{"posts", g.posts},
+		{"messages", g.messages},
+		{"counters", g.counters},
+	}
+	for _, step := range steps {
+		phase := &Phase{Name: step.name}
+		started := time.Now()
+		err := step.run(ctx, phase)
+		phase.Duration = time.Since(started)
+		if err != nil {
+			return g.report, fmt.Errorf("%s: %v", step.name, err)
+		}
+		g.report.Phases = append(g.report.Phases, phase)
+		log.WithFields(log.Fields{"phase": phase.Name, "rows": phase.Rows, "rowsPerSecond": int64(phase.Throughput())}).Info("Phase generated")
+	}
+	return g.report, nil
+}
+
+/**
+Users with realistic names, genders, birthdays, cities and
+interests. Every user gets a weight of the Chung-Lu model,
+users with bigger weights have more friends and messages
+*/
+func (g *generator) users(ctx context.Context, phase *Phase) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(g.options.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	db := config.PrimaryDataBase()
+	batch := newBulkInsert(db, "INSERT INTO users(login, password, firstName, lastName, birthDay, gender, interests, city) VALUES", 8, g.options.BatchSize)
+	batch.inserted = func(ctx context.Context, args []interface{}) error {
+		// Ids are read back, auto-increment does not promise consecutive ones
+		logins := make([]interface{}, 0, len(args)/batch.columns)
+		for i := 0; i < len(args); i += batch.columns {
+			logins = append(logins, args[i])
+		}
+		ids, err := idsByLogin(ctx, db, logins)
+		if err != nil {
+			return err
+		}
+		for _, login := range logins {
+			id, ok := ids[login.(string)]
+			if !ok {
+				return fmt.Errorf("user %s was not inserted", login)
+			}
+			g.ids = append(g.ids, id)
+		}
+		return nil
+	}
+
+	for i := 0; i < g.options.Users; i++ {
+		gender := "m"
+		firstName := pickString(g.random, maleFirstNames)
+		lastName := pickString(g.random, lastNames)
+		if g.random.Intn(2) == 0 {
+			gender = "f"
+			firstName = pickString(g.random, femaleFirstNames)
+			lastName += "a"
+		}
+		var city, userInterests *string
+		if g.random.Float64() < 0.9 {
+			name := cities[cityWeights.pick(g.random)].name
+			city = &name
+		}
+		if g.random.Float64() < 0.8 {
+			chosen := g.interests()
+			userInterests = &chosen
+		}
+		err = batch.add(ctx, phase, fmt.Sprintf("%s%d", g.options.Prefix, i+1), string(hashedPassword),
+			firstName, lastName, g.birthDay().Format("2006-01-02"), gender, userInterests, city)
+		if err != nil {
+			return err
+		}
+	}
+	if err = batch.flush(ctx, phase); err != nil {
+		return err
+	}
+
+	weights := make([]float64, len(g.ids))
+	for i := range weights {
+		weights[i] = math.Pow(float64(i+1), -1/(g.options.Exponent-1))
+	}
+	g.random.Shuffle(len(weights), func(i, j int) { weights[i], weights[j] = weights[j], weights[i] })
+	g.weights = newWeighted(weights)
+	return nil
+}
+
+func idsByLogin(ctx context.Context, db *sql.DB, logins []interface{}) (map[string]int, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(logins)), ",")
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT id, login FROM users WHERE login IN (%s)", placeholders), logins...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]int, len(logins))
+	for rows.Next() {
+		var id int
+		var login string
+		if err = rows.Scan(&id, &login); err != nil {
+			return nil, err
+		}
+		ids[login] = id
+	}
+	return ids, rows.Err()
+}
+
+/* Age is normally distributed around 30 years, from 14 to 80 */
+func (g *generator) birthDay() time.Time {
+	age := math.Max(14, math.Min(80, 30+g.random.NormFloat64()*10))
+	return g.options.Until.AddDate(0, 0, -int(age*365.25))
+}
+
+/* One to four distinct interests */
+func (g *generator) interests() string {
+	chosen := make([]string, 0, 4)
+	for _, i := range g.random.Perm(len(interests))[:1+g.random.Intn(4)] {
+		chosen = append(chosen, interests[i])
+	}
+	return strings.Join(chosen, ", ")
+}
+
+/* Moment within the year before Until */
+func (g *generator) moment() time.Time {
+	return g.options.Until.Add(-time.Duration(g.random.Int63n(int64(365 * 24 * time.Hour))))
+}
+
+/* Count of items around average, exponentially distributed */
+func (g *generator) count(average float64) int {
+	return int(math.Round(g.random.ExpFloat64() * average))
+}
+
+/**
+Friendships of the Chung-Lu model: both ends of every
+friendship are chosen by weight. Repeated pairs are
+ignored, self friendships are skipped
+*/
+func (g *generator) friends(ctx context.Context, phase *Phase) error {
+	db := config.PrimaryDataBase()
+	batch := newBulkInsert(db, "INSERT IGNORE INTO friends(user_id, friend_id) VALUES", 2, g.options.BatchSize)
+	edges := int(float64(len(g.ids)) * g.options.Friends / 2)
+	for i := 0; i < edges && len(g.ids) > 1; i++ {
+		userId := g.ids[g.weights.pick(g.random)]
+		friendId := g.ids[g.weights.pick(g.random)]
+		if userId == friendId {
+			continue
+		}
+		if err := batch.add(ctx, phase, userId, friendId, friendId, userId); err != nil {
+			return err
+		}
+	}
+	return batch.flush(ctx, phase)
+}
+
+/* Posts of users, newer posts have bigger ids */
+func (g *generator) posts(ctx context.Context, phase *Phase) error {
+	db := config.PrimaryDataBase()
+	batch := newBulkInsert(db, "INSERT INTO posts(user_id, text, friends_only_comments, created_at) VALUES", 4, g.options.BatchSize)
+	for _, id := range g.ids {
+		moments := make([]time.Time, g.count(g.options.Posts))
+		for i := range moments {
+			moments[i] = g.moment()
+		}
+		sort.Slice(moments, func(i, j int) bool { return moments[i].Before(moments[j]) })
+		for _, moment := range moments {
+			err := batch.add(ctx, phase, id, sentences(g.random, 1+g.random.Intn(4)), g.random.Float64() < 0.1, moment)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return batch.flush(ctx, phase)
+}
+
+/**
+Dialogs between users chosen by weight with messages
+written minutes apart. Dialogs are placed on shards like
+new ones, the last message is sometimes left unread
+*/
+func (g *generator) messages(ctx context.Context, phase *Phase) error {
+	dialogs := int(float64(len(g.ids)) * g.options.Dialogs / 2)
+	inserts := make(map[string]*bulkInsert)
+	if g.options.Messages == 0 {
+		return nil
+	}
+	for start := 0; start < dialogs && len(g.ids) > 1; start += g.options.BatchSize {
+		pairs := make([][2]int, 0, g.options.BatchSize)
+		keys := make([]string, 0, g.options.BatchSize)
+		for i := start; i < dialogs && i < start+g.options.BatchSize; i++ {
+			userId := g.ids[g.weights.pick(g.random)]
+			companionId := g.ids[g.weights.pick(g.random)]
+			if userId == companionId {
+				continue
+			}
+			pairs = append(pairs, [2]int{userId, companionId})
+			keys = append(keys, dialog.Key(userId, companionId))
+		}
+		owners, err := dialog.PlaceDialogs(keys)
+		if err != nil {
+			return err
+		}
+
+		for i, pair := range pairs {
+			shard, ok := owners[keys[i]]
+			if !ok {
+				continue
+			}
+			b, ok := inserts[shard]
+			if !ok {
+				db, err := config.ShardDataBase(shard)
+				if err != nil {
+					return err
+				}
+				b = newBulkInsert(db, "INSERT INTO messages(dialog_key, from_user_id, to_user_id, text, is_read, created_at) VALUES", 6, g.options.BatchSize)
+				inserts[shard] = b
+			}
+			count := 1 + g.count(math.Max(0, g.options.Messages-1))
+			moment := g.moment()
+			unread := g.random.Float64() < 0.2
+			for j := 0; j < count; j++ {
+				from, to := pair[0], pair[1]
+				if g.random.Intn(2) == 0 {
+					from, to = to, from
+				}
+				text := pickString(g.random, replies)
+				if g.random.Float64() < 0.3 {
+					text = sentences(g.random, 1)
+				}
+				moment = moment.Add(time.Duration(1+g.random.Intn(60)) * time.Minute)
+				if err = b.add(ctx, phase, keys[i], from, to, text, !(unread && j == count-1), moment); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for _, b := range inserts {
+		if err := b.flush(ctx, phase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* Unread counters are recomputed from generated messages */
+func (g *generator) counters(ctx context.Context, phase *Phase) error {
+	fixed, err := counter.Reconcile()
+	phase.Rows = int64(fixed)
+	return err
+}
+
+/* Rows written by one multi-row insert when the batch is full */
+type bulkInsert struct {
+	db       *sql.DB
+	query    string
+	columns  int
+	size     int
+	args     []interface{}
+	inserted func(ctx context.Context, args []interface{}) error
+}
+
+func newBulkInsert(db *sql.DB, query string, columns int, size int) *bulkInsert {
+	return &bulkInsert{db: db, query: query, columns: columns, size: size, args: make([]interface{}, 0, columns*size)}
+}
+
+/* Add row of one or more tuples of columns */
+func (b *bulkInsert) add(ctx context.Context, phase *Phase, values ...interface{}) error {
+	b.args = append(b.args, values...)
+	if len(b.args) >= b.columns*b.size {
+		return b.flush(ctx, phase)
+	}
+	return nil
+}
+
+func (b *bulkInsert) flush(ctx context.Context, phase *Phase) error {
+	rows := len(b.args) / b.columns
+	if rows == 0 {
+		return nil
+	}
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?,", b.columns), ",") + "),"
+	query := b.query + " " + strings.TrimSuffix(strings.Repeat(tuple, rows), ",")
+	result, err := b.db.ExecContext(ctx, query, b.args...)
+	if err != nil {
+		return err
+	}
+	if b.inserted != nil {
+		if err = b.inserted(ctx, b.args); err != nil {
+			return err
+		}
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if phase.Rows/progressRows != (phase.Rows+affected)/progressRows {
+		log.WithFields(log.Fields{"phase": phase.Name, "rows": phase.Rows + affected}).Info("Generating")
+	}
+	phase.Rows += affected
+	b.args = b.args[:0]
+	return nil
+}
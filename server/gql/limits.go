@@ -0,0 +1,162 @@
+package gql
+
+import (
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Depth and complexity of operation are checked before it
+ * is executed. Every field costs one, fields of lists cost
+ * as many times as the list may have items: the limit
+ * argument when it is given, defaultListSize otherwise.
+ * Resolvers return at most maxListSize items of a list
+ */
+
+const (
+	defaultListSize = 20
+	maxListSize     = 100
+)
+
+var maxDepth = 8
+var maxComplexity = 1000
+
+type measure struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	spreading map[string]bool
+}
+
+/* Reject operation which is deeper or more complex than allowed */
+func checkLimits(document *ast.Document, operationName string, variables map[string]interface{}) error {
+	m := &measure{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		spreading: make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			m.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			if operation == nil || (definition.Name != nil && definition.Name.Value == operationName) {
+				operation = definition
+			}
+		}
+	}
+	if operation == nil || operation.Operation != ast.OperationTypeQuery {
+		return nil
+	}
+
+	depth, complexity := m.selections(operation.SelectionSet, schema.QueryType())
+	if depth > maxDepth {
+		return fmt.Errorf("query depth %d exceeds limit %d", depth, maxDepth)
+	}
+	if complexity > maxComplexity {
+		return fmt.Errorf("query complexity %d exceeds limit %d", complexity, maxComplexity)
+	}
+	return nil
+}
+
+/* Depth and cost of selections of the object type */
+func (m *measure) selections(set *ast.SelectionSet, parent *graphql.Object) (int, int) {
+	if set == nil || parent == nil {
+		return 0, 0
+	}
+	depth, cost := 0, 0
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = m.field(selection, parent)
+		case *ast.InlineFragment:
+			d, c = m.selections(selection.SelectionSet, fragmentType(selection.TypeCondition, parent))
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := m.fragments[name]
+			if !ok || m.spreading[name] {
+				continue
+			}
+			m.spreading[name] = true
+			d, c = m.selections(fragment.SelectionSet, fragmentType(fragment.TypeCondition, parent))
+			m.spreading[name] = false
+		}
+		if d > depth {
+			depth = d
+		}
+		cost += c
+	}
+	return depth, cost
+}
+
+func (m *measure) field(field *ast.Field, parent *graphql.Object) (int, int) {
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, 0
+	}
+	definition, ok := parent.Fields()[field.Name.Value]
+	if !ok {
+		return 1, 1
+	}
+	var object *graphql.Object
+	list := false
+	for t := definition.Type; object == nil; {
+		switch typ := t.(type) {
+		case *graphql.NonNull:
+			t = typ.OfType
+		case *graphql.List:
+			list = true
+			t = typ.OfType
+		case *graphql.Object:
+			object = typ
+		default:
+			return 1, 1
+		}
+	}
+	depth, cost := m.selections(field.SelectionSet, object)
+	if list {
+		cost *= m.listSize(field)
+	}
+	return depth + 1, cost + 1
+}
+
+func (m *measure) listSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if size, err := strconv.Atoi(value.Value); err == nil {
+				return listLimit(size)
+			}
+		case *ast.Variable:
+			if size, ok := m.variables[value.Name.Value].(float64); ok {
+				return listLimit(int(size))
+			}
+		}
+	}
+	return defaultListSize
+}
+
+/* Number of items resolvers return for limit argument */
+func listLimit(limit int) int {
+	if limit <= 0 {
+		return defaultListSize
+	}
+	if limit > maxListSize {
+		return maxListSize
+	}
+	return limit
+}
+
+func fragmentType(condition *ast.Named, parent *graphql.Object) *graphql.Object {
+	if condition == nil {
+		return parent
+	}
+	object, _ := schema.Type(condition.Name.Value).(*graphql.Object)
+	return object
+}
@@ -0,0 +1,112 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"strings"
+	"testing"
+)
+
+func TestCostOfLists(t *testing.T) {
+	tests := []struct {
+		query      string
+		variables  map[string]interface{}
+		depth      int
+		complexity int
+	}{
+		{query: `{ me { id login } }`, depth: 2, complexity: 3},
+		// friends have no limit, every level is as long as the default
+		{query: `{ me { friends { id } } }`, depth: 3, complexity: 22},
+		{query: `{ me { friends { friends { id } } } }`, depth: 4, complexity: 422},
+		{query: `{ me { posts(limit: 5) { id text } } }`, depth: 3, complexity: 12},
+		{query: `{ me { posts(limit: 0) { id } } }`, depth: 3, complexity: 22},
+		{query: `{ me { friends(limit: 1000) { id } } }`, depth: 3, complexity: 102},
+		{query: `{ me { friends(limit: 2) { mutualFriends(limit: 3) { id } } } }`, depth: 4, complexity: 10},
+		{query: `query($n: Int) { me { posts(limit: $n) { id } } }`, variables: map[string]interface{}{"n": 3.0}, depth: 3, complexity: 5},
+		{query: `query($n: Int) { me { posts(limit: $n) { id } } }`, depth: 3, complexity: 22},
+		{query: `{ users(search: "Iv") { id } }`, depth: 2, complexity: 21},
+	}
+	for _, test := range tests {
+		depth, complexity := measureQuery(t, test.query, test.variables)
+		if depth != test.depth || complexity != test.complexity {
+			t.Errorf("%s: depth, complexity = %d, %d, want %d, %d", test.query, depth, complexity, test.depth, test.complexity)
+		}
+	}
+}
+
+func TestFragmentsAreMeasured(t *testing.T) {
+	depth, complexity := measureQuery(t, `{ me { ...names ... on User { city } } } fragment names on User { id login }`, nil)
+	if depth != 2 || complexity != 4 {
+		t.Errorf("depth, complexity of fragments = %d, %d, want 2, 4", depth, complexity)
+	}
+	// Validation rejects cycles later, measuring them must still end
+	depth, complexity = measureQuery(t, `{ me { ...f } } fragment f on User { id mutualFriends { ...f } }`, nil)
+	if depth != 2 || complexity != 3 {
+		t.Errorf("depth, complexity of cyclic fragment = %d, %d, want 2, 3", depth, complexity)
+	}
+	if depth, complexity = measureQuery(t, `{ __schema { types { fields { name } } } me { id } }`, nil); complexity != 2 {
+		t.Errorf("depth, complexity with introspection = %d, %d, want it to be free", depth, complexity)
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	author := func(inner string) string { return "author { posts(limit: 1) { " + inner + " } }" }
+	deepest := "{ me { posts(limit: 1) { " + author(author(author("id"))) + " } } }"
+	if err := checkLimits(parseQuery(t, strings.Replace(deepest, author("id"), "author { id }", 1)), "", nil); err != nil {
+		t.Errorf("query of maximum depth: %v", err)
+	}
+	err := checkLimits(parseQuery(t, deepest), "", nil)
+	if err == nil || err.Error() != "query depth 9 exceeds limit 8" {
+		t.Errorf("too deep query error = %v", err)
+	}
+
+	err = checkLimits(parseQuery(t, `{ me { friends { friends { friends { id } } } } }`), "", nil)
+	if err == nil || err.Error() != "query complexity 8422 exceeds limit 1000" {
+		t.Errorf("too complex query error = %v", err)
+	}
+
+	operations := parseQuery(t, `query Small { me { id } } query Big { me { friends { friends { friends { id } } } } }`)
+	if err = checkLimits(operations, "Small", nil); err != nil {
+		t.Errorf("named small operation error = %v", err)
+	}
+	if err = checkLimits(operations, "Big", nil); err == nil {
+		t.Error("named big operation must be rejected")
+	}
+	if err = checkLimits(parseQuery(t, `mutation { a { b { c { d { e { f { g { h { i } } } } } } } } }`), "", nil); err != nil {
+		t.Errorf("mutation error = %v, schema has no mutations to measure", err)
+	}
+}
+
+func TestListLimit(t *testing.T) {
+	for limit, want := range map[int]int{-1: defaultListSize, 0: defaultListSize, 1: 1, maxListSize: maxListSize, maxListSize + 1: maxListSize} {
+		if got := listLimit(limit); got != want {
+			t.Errorf("listLimit(%d) = %d, want %d", limit, got, want)
+		}
+	}
+}
+
+func measureQuery(t *testing.T, query string, variables map[string]interface{}) (int, int) {
+	m := &measure{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: variables,
+		spreading: make(map[string]bool),
+	}
+	var operation *ast.OperationDefinition
+	for _, definition := range parseQuery(t, query).Definitions {
+		switch definition := definition.(type) {
+		case *ast.FragmentDefinition:
+			m.fragments[definition.Name.Value] = definition
+		case *ast.OperationDefinition:
+			operation = definition
+		}
+	}
+	return m.selections(operation.SelectionSet, schema.QueryType())
+}
+
+func parseQuery(t *testing.T, query string) *ast.Document {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		t.Fatalf("cannot parse %s: %v", query, err)
+	}
+	return document
+}
@@ -0,0 +1,162 @@
+package gql
+
+import (
+	"context"
+	"social-network-study/model/post"
+	"social-network-study/model/user"
+)
+
+/**
+ * Loaders batch ids requested by resolvers of one level of
+ * query. Resolvers return thunks which are called breadth-first
+ * after the whole level is resolved, so the first thunk fetches
+ * every pending id in one query. Queries are executed serially,
+ * loaders live for one request and need no locking
+ */
+
+type loader struct {
+	fetch   func(ids []int) (map[int]interface{}, error)
+	pending []int
+	loaded  map[int]interface{}
+	failed  map[int]error
+}
+
+func newLoader(fetch func(ids []int) (map[int]interface{}, error)) *loader {
+	return &loader{fetch: fetch, loaded: make(map[int]interface{}), failed: make(map[int]error)}
+}
+
+/* Queue id and return thunk resolving it, nil when it is not found */
+func (l *loader) load(id int) func() (interface{}, error) {
+	if _, ok := l.loaded[id]; !ok && l.failed[id] == nil {
+		l.pending = append(l.pending, id)
+	}
+	return func() (interface{}, error) {
+		l.flush()
+		if err := l.failed[id]; err != nil {
+			return nil, err
+		}
+		return l.loaded[id], nil
+	}
+}
+
+/* Value which is already known, so it is not fetched */
+func (l *loader) prime(id int, value interface{}) {
+	if _, ok := l.loaded[id]; !ok {
+		l.loaded[id] = value
+	}
+}
+
+func (l *loader) flush() {
+	if len(l.pending) == 0 {
+		return
+	}
+	ids := l.pending
+	l.pending = nil
+	values, err := l.fetch(ids)
+	for _, id := range ids {
+		if err != nil {
+			l.failed[id] = err
+		} else if _, ok := l.loaded[id]; !ok {
+			l.loaded[id] = values[id]
+		}
+	}
+}
+
+/* Loaders and viewer of one request */
+type loaders struct {
+	viewer     *user.User
+	users      *loader
+	friends    *loader
+	posts      map[postsPage]*loader
+	fetchPosts func(ids []int, page postsPage) (map[int][]*post.Post, error)
+}
+
+/* Arguments of posts field, users asking for the same page are batched */
+type postsPage struct {
+	before int
+	limit  int
+}
+
+type loadersKey struct{}
+
+func withLoaders(ctx context.Context, viewer *user.User) context.Context {
+	l := &loaders{viewer: viewer, posts: make(map[postsPage]*loader)}
+	l.users = newLoader(func(ids []int) (map[int]interface{}, error) {
+		users, err := user.FetchUsersByIds(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[int]interface{}, len(users))
+		for _, u := range users {
+			values[u.ID] = u
+		}
+		return values, nil
+	})
+	l.friends = newLoader(func(ids []int) (map[int]interface{}, error) {
+		friends, err := user.FetchFriendsOfUsers(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		values := make(map[int]interface{}, len(ids))
+		for _, id := range ids {
+			for _, friend := range friends[id] {
+				l.users.prime(friend.ID, friend)
+			}
+			values[id] = friends[id]
+		}
+		return values, nil
+	})
+	l.fetchPosts = func(ids []int, page postsPage) (map[int][]*post.Post, error) {
+		return post.FetchPostsOfUsers(ids, viewer.ID, page.before, page.limit)
+	}
+	l.users.prime(viewer.ID, viewer)
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersOf(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+/* Thunk resolving friends of user */
+func (l *loaders) loadFriends(id int) func() ([]*user.User, error) {
+	thunk := l.friends.load(id)
+	return func() ([]*user.User, error) {
+		friends, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		list, _ := friends.([]*user.User)
+		return list, nil
+	}
+}
+
+/* Thunk resolving page of posts of user */
+func (l *loaders) loadPosts(id int, page postsPage) func() ([]*post.Post, error) {
+	posts, ok := l.posts[page]
+	if !ok {
+		posts = newLoader(func(ids []int) (map[int]interface{}, error) {
+			pages, err := l.fetchPosts(ids, page)
+			if err != nil {
+				return nil, err
+			}
+			values := make(map[int]interface{}, len(ids))
+			for _, id := range ids {
+				values[id] = pages[id]
+			}
+			return values, nil
+		})
+		l.posts[page] = posts
+	}
+	thunk := posts.load(id)
+	return func() ([]*post.Post, error) {
+		page, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		list, _ := page.([]*post.Post)
+		if list == nil {
+			list = make([]*post.Post, 0)
+		}
+		return list, nil
+	}
+}
@@ -0,0 +1,79 @@
+package gql
+
+import (
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"net/http"
+	"social-network-study/config"
+	"social-network-study/model/user"
+)
+
+type query struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+func Init(cfg *config.Config) {
+	if cfg.GraphQL.MaxDepth > 0 {
+		maxDepth = cfg.GraphQL.MaxDepth
+	}
+	if cfg.GraphQL.MaxComplexity > 0 {
+		maxComplexity = cfg.GraphQL.MaxComplexity
+	}
+}
+
+/**
+Execute GraphQL query of the current user. Errors of
+query are returned in result, like errors of fields
+*/
+func PostQuery(w http.ResponseWriter, r *http.Request) {
+	q := new(query)
+	err := json.NewDecoder(r.Body).Decode(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currentUser, err := user.GetCurrentPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(q.Query), Name: "GraphQL request"})})
+	if err != nil {
+		writeResult(w, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	validation := graphql.ValidateDocument(&schema, document, nil)
+	if !validation.IsValid {
+		writeResult(w, &graphql.Result{Errors: validation.Errors})
+		return
+	}
+	if err = checkLimits(document, q.OperationName, q.Variables); err != nil {
+		writeResult(w, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           document,
+		OperationName: q.OperationName,
+		Args:          q.Variables,
+		Context:       withLoaders(r.Context(), currentUser),
+	})
+	writeResult(w, result)
+}
+
+func writeResult(w http.ResponseWriter, result *graphql.Result) {
+	w.Header().Add("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
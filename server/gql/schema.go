@@ -0,0 +1,211 @@
+package gql
+
+import (
+	"github.com/graphql-go/graphql"
+	"social-network-study/model/post"
+	"social-network-study/model/user"
+	"strings"
+)
+
+/**
+ * Schema over users, friends, mutual friends and posts.
+ * Users and posts are resolved through loaders of the
+ * request, so lists of friends take one query per level
+ * of query
+ */
+
+var schema graphql.Schema
+
+var userType *graphql.Object
+var postType *graphql.Object
+
+func init() {
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"login":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"firstName": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"lastName":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"birthDay":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"gender":    &graphql.Field{Type: graphql.String},
+				"interests": &graphql.Field{Type: graphql.String},
+				"city":      &graphql.Field{Type: graphql.String},
+				"online":    &graphql.Field{Type: graphql.Boolean, Description: "Empty when the user hides presence"},
+				"lastSeen":  &graphql.Field{Type: graphql.String},
+				"friends": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+					Description: "Friends whose first or last name starts with search",
+					Args: graphql.FieldConfigArgument{
+						"search": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: ""},
+						"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListSize},
+					},
+					Resolve: resolveFriends,
+				},
+				"mutualFriends": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+					Description: "Friends the user has in common with the current user",
+					Args: graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListSize},
+					},
+					Resolve: resolveMutualFriends,
+				},
+				"posts": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(postType))),
+					Description: "Page of posts, newest first",
+					Args: graphql.FieldConfigArgument{
+						"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListSize},
+						"before": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "Id of the last post of previous page"},
+					},
+					Resolve: resolvePosts,
+				},
+			}
+		}),
+	})
+
+	postType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.Fields{
+			"id":                  &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"text":                &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"createdAt":           &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"likesCount":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"commentsCount":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"liked":               &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Description: "Liked by the current user"},
+			"friendsOnlyComments": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"author": &graphql.Field{
+				Type: userType,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersOf(p.Context).users.load(p.Source.(*post.Post).UserId), nil
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersOf(p.Context).viewer, nil
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return loadersOf(p.Context).users.load(p.Args["id"].(int)), nil
+				},
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(userType)),
+				Description: "Users whose first and last names start with search",
+				Args: graphql.FieldConfigArgument{
+					"search": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+					"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultListSize},
+				},
+				Resolve: resolveUsers,
+			},
+			"post": &graphql.Field{
+				Type: postType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: resolvePost,
+			},
+		},
+	})
+
+	var err error
+	schema, err = graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func resolveFriends(p graphql.ResolveParams) (interface{}, error) {
+	search := strings.ToLower(p.Args["search"].(string))
+	limit := listLimit(p.Args["limit"].(int))
+	thunk := loadersOf(p.Context).loadFriends(p.Source.(*user.User).ID)
+	return func() (interface{}, error) {
+		friends, err := thunk()
+		if err != nil {
+			return nil, err
+		}
+		found := make([]*user.User, 0, len(friends))
+		for _, friend := range friends {
+			if len(found) == limit {
+				break
+			}
+			if strings.HasPrefix(strings.ToLower(friend.FirstName), search) || strings.HasPrefix(strings.ToLower(friend.LastName), search) {
+				found = append(found, friend)
+			}
+		}
+		return found, nil
+	}, nil
+}
+
+func resolveMutualFriends(p graphql.ResolveParams) (interface{}, error) {
+	l := loadersOf(p.Context)
+	limit := listLimit(p.Args["limit"].(int))
+	theirs := l.loadFriends(p.Source.(*user.User).ID)
+	ours := l.loadFriends(l.viewer.ID)
+	return func() (interface{}, error) {
+		friends, err := theirs()
+		if err != nil {
+			return nil, err
+		}
+		viewerFriends, err := ours()
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[int]bool, len(viewerFriends))
+		for _, friend := range viewerFriends {
+			known[friend.ID] = true
+		}
+		mutual := make([]*user.User, 0)
+		for _, friend := range friends {
+			if len(mutual) == limit {
+				break
+			}
+			if known[friend.ID] {
+				mutual = append(mutual, friend)
+			}
+		}
+		return mutual, nil
+	}, nil
+}
+
+func resolvePosts(p graphql.ResolveParams) (interface{}, error) {
+	page := postsPage{before: p.Args["before"].(int), limit: listLimit(p.Args["limit"].(int))}
+	thunk := loadersOf(p.Context).loadPosts(p.Source.(*user.User).ID, page)
+	return func() (interface{}, error) {
+		return thunk()
+	}, nil
+}
+
+/* Found users are loaded by id, all of them in one query */
+func resolveUsers(p graphql.ResolveParams) (interface{}, error) {
+	found, err := user.FetchFullUsers(p.Context, p.Args["search"].(string), listLimit(p.Args["limit"].(int)))
+	if err != nil {
+		return nil, err
+	}
+	users := loadersOf(p.Context).users
+	thunks := make([]interface{}, len(found))
+	for i, f := range found {
+		thunks[i] = users.load(f.ID)
+	}
+	return thunks, nil
+}
+
+func resolvePost(p graphql.ResolveParams) (interface{}, error) {
+	found, err := post.FetchPostById(p.Args["id"].(int), loadersOf(p.Context).viewer.ID)
+	if err == post.ErrPostNotFound {
+		return nil, nil
+	}
+	return found, err
+}
@@ -0,0 +1,113 @@
+package gql
+
+import (
+	"context"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"reflect"
+	"social-network-study/model/post"
+	"social-network-study/model/user"
+	"testing"
+)
+
+func TestFriendsAreCutAtLimit(t *testing.T) {
+	viewer := &user.User{ID: 1}
+	friends := make([]*user.User, 0)
+	for id := 2; id < 2+maxListSize+10; id++ {
+		friends = append(friends, &user.User{ID: id, FirstName: fmt.Sprintf("Ivan%d", id), LastName: "Petrov"})
+	}
+	ctx := withFriends(viewer, map[int][]*user.User{1: friends, 2: friends[1:]})
+
+	for limit, want := range map[int]int{3: 3, 0: defaultListSize, 1000: maxListSize} {
+		resolved := resolve(t, resolveFriends, ctx, viewer, map[string]interface{}{"search": "", "limit": limit})
+		if len(resolved) != want {
+			t.Errorf("friends(limit: %d) = %d friends, want %d", limit, len(resolved), want)
+		}
+	}
+	resolved := resolve(t, resolveFriends, ctx, viewer, map[string]interface{}{"search": "ivan10", "limit": 5})
+	if len(resolved) != 5 || resolved[0].ID != 10 {
+		t.Errorf("friends(search: ivan10, limit: 5) = %d friends from %d, want the matching ones only", len(resolved), resolved[0].ID)
+	}
+	resolved = resolve(t, resolveMutualFriends, ctx, friends[0], map[string]interface{}{"limit": 4})
+	if len(resolved) != 4 || resolved[0].ID != 3 {
+		t.Errorf("mutualFriends(limit: 4) = %d friends", len(resolved))
+	}
+}
+
+func TestPostsOfFriendsAreBatched(t *testing.T) {
+	viewer := &user.User{ID: 1}
+	ctx := withFriends(viewer, nil)
+	fetched := make([][]int, 0)
+	loadersOf(ctx).fetchPosts = func(ids []int, page postsPage) (map[int][]*post.Post, error) {
+		fetched = append(fetched, ids)
+		pages := make(map[int][]*post.Post)
+		for _, id := range ids {
+			if id%2 == 0 {
+				pages[id] = []*post.Post{{ID: id * 10, UserId: id}}
+			}
+		}
+		return pages, nil
+	}
+
+	thunks := make([]func() (interface{}, error), 0)
+	for id := 2; id <= 5; id++ {
+		result, err := resolvePosts(graphql.ResolveParams{Context: ctx, Source: &user.User{ID: id}, Args: map[string]interface{}{"before": 0, "limit": 5}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		thunks = append(thunks, result.(func() (interface{}, error)))
+	}
+	other, err := resolvePosts(graphql.ResolveParams{Context: ctx, Source: &user.User{ID: 2}, Args: map[string]interface{}{"before": 100, "limit": 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	thunks = append(thunks, other.(func() (interface{}, error)))
+
+	for i, thunk := range thunks {
+		resolved, err := thunk()
+		if err != nil {
+			t.Fatal(err)
+		}
+		posts := resolved.([]*post.Post)
+		if id := i + 2; i < 4 && (id%2 == 0) != (len(posts) == 1) {
+			t.Errorf("posts of user %d = %d posts", id, len(posts))
+		}
+		if posts == nil {
+			t.Errorf("posts of thunk %d are nil, want empty list", i)
+		}
+	}
+	if want := [][]int{{2, 3, 4, 5}, {2}}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("posts fetched for users %v, want %v, one query per page of arguments", fetched, want)
+	}
+}
+
+/* Loaders of request whose friends are known, users and posts are never fetched */
+func withFriends(viewer *user.User, friends map[int][]*user.User) context.Context {
+	l := &loaders{viewer: viewer, posts: make(map[postsPage]*loader)}
+	l.fetchPosts = func(ids []int, page postsPage) (map[int][]*post.Post, error) {
+		return nil, fmt.Errorf("posts of users %v are fetched", ids)
+	}
+	l.users = newLoader(func(ids []int) (map[int]interface{}, error) {
+		return nil, fmt.Errorf("users %v are fetched", ids)
+	})
+	l.friends = newLoader(func(ids []int) (map[int]interface{}, error) {
+		values := make(map[int]interface{}, len(ids))
+		for _, id := range ids {
+			values[id] = friends[id]
+		}
+		return values, nil
+	})
+	return context.WithValue(context.Background(), loadersKey{}, l)
+}
+
+func resolve(t *testing.T, resolver graphql.FieldResolveFn, ctx context.Context, source *user.User, args map[string]interface{}) []*user.User {
+	result, err := resolver(graphql.ResolveParams{Context: ctx, Source: source, Args: args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := result.(func() (interface{}, error))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolved.([]*user.User)
+}
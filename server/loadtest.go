@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"social-network-study/loadtest"
+	"strings"
+	"syscall"
+)
+
+/**
+Subcommand load testing the REST API with users created by seed:
+  server loadtest -url http://localhost:8080 -rps 200 -duration 2m
+  server loadtest -mix search=1 -json > before.json
+Interrupting the test reports requests sent so far
+*/
+func loadtestCommand(args []string) {
+	options := loadtest.DefaultOptions()
+	flags := newFlagSet("loadtest", "")
+	flags.StringVar(&options.BaseURL, "url", options.BaseURL, "Base URL of the server")
+	flags.IntVar(&options.Users, "users", options.Users, "Number of generated users to log in")
+	flags.StringVar(&options.Prefix, "prefix", options.Prefix, "Prefix of logins of generated users")
+	flags.StringVar(&options.Password, "password", options.Password, "Password of generated users")
+	flags.Float64Var(&options.Rate, "rps", options.Rate, "Target rate of requests per second")
+	flags.DurationVar(&options.Duration, "duration", options.Duration, "Duration of the test")
+	flags.DurationVar(&options.Timeout, "timeout", options.Timeout, "Timeout of one request")
+	flags.IntVar(&options.MaxInFlight, "max-inflight", options.MaxInFlight, "Requests in flight, the ones above are dropped and count as errors")
+	flags.Int64Var(&options.Seed, "seed", options.Seed, "Seed of random choice of scenarios and users")
+	mix := flags.String("mix", "search=1,profile=4,friend=2,feed=3", "Weights of scenarios: "+strings.Join(loadtest.Scenarios(), ", "))
+	asJson := flags.Bool("json", false, "Print report as JSON")
+	cfg := loadConfig(flags, args)
+	if cfg == nil {
+		return
+	}
+	requireArgs(flags, 0)
+
+	var err error
+	if options.Mix, err = loadtest.ParseMix(*mix); err != nil {
+		log.Fatalf("Invalid mix... %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	report, err := loadtest.Run(ctx, options)
+	if err != nil {
+		log.Fatalf("Load test failed... %v", err)
+	}
+	if *asJson {
+		err = json.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		err = report.Print(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Cannot print report... %v", err)
+	}
+}
@@ -0,0 +1,425 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+/**
+ * Load test of the REST API. Generated users log in, then
+ * requests of weighted scenarios are started at the target
+ * rate no matter how fast the server answers (open loop).
+ * Latency is measured from the moment request was scheduled,
+ * so that a slow server can not hide its queueing delay
+ */
+
+const loginWorkers = 16
+
+var errDropped = errors.New("dropped, too many requests in flight")
+
+type Options struct {
+	BaseURL     string
+	Users       int
+	Prefix      string
+	Password    string
+	Rate        float64 // requests per second
+	Duration    time.Duration
+	Timeout     time.Duration
+	MaxInFlight int
+	Mix         map[string]float64
+	Seed        int64
+}
+
+type session struct {
+	login   string
+	id      int
+	token   string
+	friends map[int]bool // friends from seed
+}
+
+/* Outcome of one request, dropped ones have no latency */
+type sample struct {
+	scenario string
+	latency  time.Duration
+	status   int
+	err      error
+	dropped  bool
+}
+
+/* Latencies are in milliseconds */
+type Stats struct {
+	Scenario   string         `json:"scenario"`
+	Requests   int            `json:"requests"`
+	Errors     int            `json:"errors"`
+	ErrorRate  float64        `json:"errorRate"`
+	Throughput float64        `json:"throughput"`
+	Mean       float64        `json:"meanMs"`
+	P50        float64        `json:"p50Ms"`
+	P90        float64        `json:"p90Ms"`
+	P95        float64        `json:"p95Ms"`
+	P99        float64        `json:"p99Ms"`
+	Max        float64        `json:"maxMs"`
+	Statuses   map[string]int `json:"statuses"`
+}
+
+type Report struct {
+	Target    string   `json:"target"`
+	Rate      float64  `json:"rate"`
+	Duration  float64  `json:"durationSeconds"`
+	Users     int      `json:"users"`
+	Scheduled int      `json:"scheduled"`
+	Dropped   int      `json:"dropped"`
+	Total     *Stats   `json:"total"`
+	Scenarios []*Stats `json:"scenarios"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		BaseURL:     "http://localhost:8080",
+		Users:       100,
+		Prefix:      "user",
+		Password:    "password",
+		Rate:        50,
+		Duration:    time.Minute,
+		Timeout:     10 * time.Second,
+		MaxInFlight: 1000,
+		Mix:         map[string]float64{"search": 1, "profile": 4, "friend": 2, "feed": 3},
+		Seed:        1,
+	}
+}
+
+/* Options must describe some load */
+func (o Options) Validate() error {
+	total := 0.0
+	for _, weight := range o.Mix {
+		total += weight
+	}
+	switch {
+	case o.BaseURL == "":
+		return errors.New("url of the server is required")
+	case o.Users <= 0:
+		return errors.New("number of users must be positive")
+	case o.Rate <= 0 || o.Duration <= 0 || o.Timeout <= 0 || o.MaxInFlight <= 0:
+		return errors.New("rate, duration, timeout and max in-flight requests must be positive")
+	case total <= 0:
+		return errors.New("mix must have a scenario with positive weight")
+	}
+	return nil
+}
+
+/* Log in users, run scenarios for the duration and report results */
+func Run(ctx context.Context, options Options) (*Report, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Timeout:   options.Timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: options.MaxInFlight, MaxIdleConns: options.MaxInFlight},
+	}
+	base := strings.TrimSuffix(options.BaseURL, "/")
+
+	sessions, err := login(ctx, client, base, options)
+	if err != nil {
+		return nil, err
+	}
+	log.WithField("users", len(sessions)).Info("Users logged in")
+
+	names := make([]string, 0, len(options.Mix))
+	weights := make([]float64, 0, len(options.Mix))
+	for _, name := range Scenarios() {
+		if weight := options.Mix[name]; weight > 0 {
+			names = append(names, name)
+			weights = append(weights, weight)
+		}
+	}
+	for i := 1; i < len(weights); i++ {
+		weights[i] += weights[i-1]
+	}
+
+	l := &load{base: base, random: rand.New(rand.NewSource(options.Seed)), sessions: sessions, added: make(map[[2]int]bool)}
+	samples := make(chan sample, options.MaxInFlight)
+	results := make([]sample, 0, int(options.Rate*options.Duration.Seconds()))
+	collected := make(chan struct{})
+	go func() {
+		for s := range samples {
+			results = append(results, s)
+		}
+		close(collected)
+	}()
+
+	report := &Report{Target: base, Rate: options.Rate, Users: len(sessions)}
+	inFlight := make(chan struct{}, options.MaxInFlight)
+	var wg sync.WaitGroup
+	interval := time.Duration(float64(time.Second) / options.Rate)
+	started := time.Now()
+	log.WithFields(log.Fields{"rate": options.Rate, "duration": options.Duration.String()}).Info("Load started")
+schedule:
+	for i := 0; ; i++ {
+		scheduled := started.Add(time.Duration(i) * interval)
+		if scheduled.Sub(started) >= options.Duration {
+			break
+		}
+		if wait := time.Until(scheduled); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				log.Warn("Load interrupted, reporting requests sent so far")
+				break schedule
+			}
+		}
+		report.Scheduled++
+
+		point := l.random.Float64() * weights[len(weights)-1]
+		name := names[sort.SearchFloat64s(weights, point)]
+		user, other := pickPair(l.random, len(sessions))
+		request, err := scenarios[name](l, sessions[user], sessions[other])
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			report.Dropped++
+			samples <- sample{scenario: name, err: errDropped, dropped: true}
+			continue
+		}
+		wg.Add(1)
+		go func(name string, request *http.Request, scheduled time.Time) {
+			defer wg.Done()
+			defer func() { <-inFlight }()
+			samples <- send(ctx, client, name, request, scheduled)
+		}(name, request, scheduled)
+	}
+	wg.Wait()
+	close(samples)
+	<-collected
+
+	elapsed := time.Since(started)
+	report.Duration = elapsed.Seconds()
+	report.Total, report.Scenarios = summarize(results, elapsed)
+	return report, nil
+}
+
+/* Indexes of user and another user, the same one when it is alone */
+func pickPair(random *rand.Rand, count int) (int, int) {
+	user := random.Intn(count)
+	if count == 1 {
+		return user, user
+	}
+	other := random.Intn(count - 1)
+	if other >= user {
+		other++
+	}
+	return user, other
+}
+
+func send(ctx context.Context, client *http.Client, name string, request *http.Request, scheduled time.Time) sample {
+	response, err := client.Do(request.WithContext(ctx))
+	result := sample{scenario: name}
+	if err == nil {
+		io.Copy(ioutil.Discard, response.Body)
+		response.Body.Close()
+		result.status = response.StatusCode
+		if response.StatusCode >= http.StatusBadRequest {
+			err = fmt.Errorf("status %d", response.StatusCode)
+		}
+	}
+	result.latency = time.Since(scheduled)
+	result.err = err
+	return result
+}
+
+/**
+Log in users prefix1..prefixN created by the seed command,
+users which can not log in are skipped
+*/
+func login(ctx context.Context, client *http.Client, base string, options Options) ([]*session, error) {
+	logins := make(chan string)
+	var mutex sync.Mutex
+	var lastErr error
+	sessions := make([]*session, 0, options.Users)
+	var wg sync.WaitGroup
+	for i := 0; i < loginWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range logins {
+				s, err := signIn(ctx, client, base, name, options.Password)
+				mutex.Lock()
+				if err != nil {
+					lastErr = err
+				} else {
+					sessions = append(sessions, s)
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for i := 1; i <= options.Users; i++ {
+		logins <- fmt.Sprintf("%s%d", options.Prefix, i)
+	}
+	close(logins)
+	wg.Wait()
+
+	if len(sessions) == 0 {
+		return nil, fmt.Errorf("no user could log in: %v", lastErr)
+	}
+	if len(sessions) < options.Users {
+		log.WithError(lastErr).Warnf("Only %d of %d users logged in", len(sessions), options.Users)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+	return sessions, nil
+}
+
+/* Token of user from /singin, id from /current-user */
+func signIn(ctx context.Context, client *http.Client, base string, login string, password string) (*session, error) {
+	body, _ := json.Marshal(map[string]string{"login": login, "password": password})
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/api/v1/singin", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("login %s: status %d", login, response.StatusCode)
+	}
+	s := &session{login: login, token: strings.TrimPrefix(response.Header.Get("Authorization"), "Bearer "), friends: make(map[int]bool)}
+
+	current := new(struct {
+		ID int `json:"id"`
+	})
+	if err = s.get(ctx, client, base+"/api/v1/current-user", current); err != nil {
+		return nil, fmt.Errorf("current user %s: %v", login, err)
+	}
+	s.id = current.ID
+
+	friends := make([]struct {
+		ID int `json:"id"`
+	}, 0)
+	if err = s.get(ctx, client, fmt.Sprintf("%s/api/v1/friends?id=%d", base, s.id), &friends); err != nil {
+		return nil, fmt.Errorf("friends of %s: %v", login, err)
+	}
+	for _, friend := range friends {
+		s.friends[friend.ID] = true
+	}
+	return s, nil
+}
+
+/* Decode JSON answer of GET request of the session user */
+func (s *session) get(ctx context.Context, client *http.Client, target string, result interface{}) error {
+	request, err := s.request(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+/* Statistics of all requests and of every scenario */
+func summarize(results []sample, elapsed time.Duration) (*Stats, []*Stats) {
+	byScenario := make(map[string][]sample)
+	for _, result := range results {
+		byScenario[result.scenario] = append(byScenario[result.scenario], result)
+	}
+	stats := make([]*Stats, 0, len(byScenario))
+	for _, name := range Scenarios() {
+		if samples, ok := byScenario[name]; ok {
+			stats = append(stats, newStats(name, samples, elapsed))
+		}
+	}
+	return newStats("total", results, elapsed), stats
+}
+
+func newStats(name string, samples []sample, elapsed time.Duration) *Stats {
+	stats := &Stats{Scenario: name, Requests: len(samples), Statuses: make(map[string]int)}
+	if len(samples) == 0 {
+		return stats
+	}
+	latencies := make([]float64, 0, len(samples))
+	total := 0.0
+	for _, s := range samples {
+		if s.err != nil {
+			stats.Errors++
+		}
+		status := "error"
+		switch {
+		case s.dropped:
+			status = "dropped"
+		case s.status != 0:
+			status = fmt.Sprintf("%d", s.status)
+		}
+		stats.Statuses[status]++
+		if s.dropped {
+			continue
+		}
+		latency := float64(s.latency) / float64(time.Millisecond)
+		latencies = append(latencies, latency)
+		total += latency
+	}
+	stats.ErrorRate = float64(stats.Errors) / float64(len(samples))
+	// Dropped requests are errors, but were never answered
+	stats.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	if len(latencies) == 0 {
+		return stats
+	}
+	sort.Float64s(latencies)
+	stats.Mean = total / float64(len(latencies))
+	stats.P50 = percentile(latencies, 50)
+	stats.P90 = percentile(latencies, 90)
+	stats.P95 = percentile(latencies, 95)
+	stats.P99 = percentile(latencies, 99)
+	stats.Max = latencies[len(latencies)-1]
+	return stats
+}
+
+/* Nearest-rank percentile of sorted values */
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+/* Print report as a table, latencies are in milliseconds */
+func (r *Report) Print(w io.Writer) error {
+	fmt.Fprintf(w, "Target %s, %d users, %.0f req/s for %.1fs: %d scheduled, %d dropped\n\n",
+		r.Target, r.Users, r.Rate, r.Duration, r.Scheduled, r.Dropped)
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "SCENARIO\tREQUESTS\tERRORS\tREQ/S\tMEAN\tP50\tP90\tP95\tP99\tMAX\t")
+	for _, stats := range append(r.Scenarios, r.Total) {
+		fmt.Fprintf(table, "%s\t%d\t%.2f%%\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t\n",
+			stats.Scenario, stats.Requests, stats.ErrorRate*100, stats.Throughput,
+			stats.Mean, stats.P50, stats.P90, stats.P95, stats.P99, stats.Max)
+	}
+	return table.Flush()
+}
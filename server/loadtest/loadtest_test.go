@@ -0,0 +1,131 @@
+package loadtest
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPercentileOfFewValues(t *testing.T) {
+	// Nearest rank never interpolates, p99 of few values is the slowest one
+	ten := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for p, want := range map[float64]float64{0: 1, 50: 5, 90: 9, 94: 9, 95: 10, 99: 10, 100: 10} {
+		if got := percentile(ten, p); got != want {
+			t.Errorf("p%v of ten = %v, want %v", p, got, want)
+		}
+	}
+	for _, p := range []float64{0, 50, 99} {
+		if got := percentile([]float64{7}, p); got != 7 {
+			t.Errorf("p%v of single value = %v, want 7", p, got)
+		}
+	}
+}
+
+func TestPickPairNeverPicksSameUser(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		user, other := pickPair(random, 3)
+		if user == other || other < 0 || other >= 3 {
+			t.Fatalf("pickPair() = %d, %d of three users", user, other)
+		}
+		seen[other] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("others picked %v, want every user", seen)
+	}
+	if user, other := pickPair(random, 1); user != 0 || other != 0 {
+		t.Errorf("pickPair() of one user = %d, %d", user, other)
+	}
+}
+
+func TestSummarizeByScenario(t *testing.T) {
+	results := []sample{
+		{scenario: "search", latency: 10 * time.Millisecond, status: 200},
+		{scenario: "profile", latency: 30 * time.Millisecond, status: 404, err: errors.New("status 404")},
+		{scenario: "search", latency: 20 * time.Millisecond, status: 200},
+		{scenario: "profile", latency: 50 * time.Millisecond, err: errors.New("connection refused")},
+	}
+	total, scenarios := summarize(results, 2*time.Second)
+
+	want := Stats{
+		Scenario: "total", Requests: 4, Errors: 2, ErrorRate: 0.5, Throughput: 2,
+		Mean: 27.5, P50: 20, P90: 50, P95: 50, P99: 50, Max: 50,
+		Statuses: map[string]int{"200": 2, "404": 1, "error": 1},
+	}
+	if !reflect.DeepEqual(*total, want) {
+		t.Errorf("total = %+v, want %+v", *total, want)
+	}
+	if len(scenarios) != 2 || scenarios[0].Scenario != "profile" || scenarios[1].Scenario != "search" {
+		t.Fatalf("scenarios = %+v, want profile and search in order of names", scenarios)
+	}
+	if scenarios[1].Errors != 0 || scenarios[1].Mean != 15 || scenarios[1].Throughput != 1 {
+		t.Errorf("search = %+v", *scenarios[1])
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix(" search=1, profile = 4 ,feed,")
+	want := map[string]float64{"search": 1, "profile": 4, "feed": 1}
+	if err != nil || !reflect.DeepEqual(mix, want) {
+		t.Errorf("ParseMix() = %v, %v, want %v", mix, err, want)
+	}
+	for _, text := range []string{"serach=1", "search=-1", "search=often", "=1"} {
+		if mix, err := ParseMix(text); err == nil {
+			t.Errorf("ParseMix(%q) = %v, want error", text, mix)
+		}
+	}
+}
+
+func TestDroppedRequestsHaveNoLatency(t *testing.T) {
+	results := []sample{
+		{scenario: "feed", latency: 10 * time.Millisecond, status: 200},
+		{scenario: "feed", err: errDropped, dropped: true},
+		{scenario: "feed", err: errDropped, dropped: true},
+		{scenario: "feed", latency: 30 * time.Millisecond, status: 200},
+	}
+	stats := newStats("feed", results, time.Second)
+	if stats.Requests != 4 || stats.Errors != 2 || stats.ErrorRate != 0.5 || stats.Statuses["dropped"] != 2 {
+		t.Errorf("stats = %+v, want dropped requests counted as errors", *stats)
+	}
+	// Zero latency of dropped requests would make the server look faster under overload
+	if stats.Mean != 20 || stats.P50 != 10 || stats.Throughput != 2 {
+		t.Errorf("stats = %+v, want latency and throughput of answered requests only", *stats)
+	}
+
+	stats = newStats("feed", results[1:3], time.Second)
+	if stats.Errors != 2 || stats.Max != 0 || stats.Throughput != 0 {
+		t.Errorf("stats of dropped requests only = %+v", *stats)
+	}
+}
+
+func TestFriendScenarioKeepsFriendsOfSeed(t *testing.T) {
+	alice := &session{id: 1, token: "a", friends: map[int]bool{2: true}}
+	bob := &session{id: 2, token: "b", friends: map[int]bool{1: true}}
+	carol := &session{id: 3, token: "c", friends: map[int]bool{}}
+	l := &load{base: "http://test", random: rand.New(rand.NewSource(1)), sessions: []*session{alice, bob, carol}, added: make(map[[2]int]bool)}
+
+	request, err := friendScenario(l, alice, carol)
+	if err != nil || request.Method != "POST" {
+		t.Fatalf("friendScenario() of non-friend = %v, %v, want friendship added", request, err)
+	}
+	request, _ = friendScenario(l, carol, alice)
+	if request.Method != "DELETE" || len(l.added) != 0 {
+		t.Errorf("friendScenario() of added friend = %s, want it removed", request.Method)
+	}
+	request, _ = friendScenario(l, alice, bob)
+	if request.Method == "DELETE" {
+		t.Error("friendship of seed is removed")
+	}
+	if request.Method == "POST" && !l.added[[2]int{1, 3}] {
+		t.Errorf("friendScenario() added friendship of seed, added %v", l.added)
+	}
+
+	everyone := &session{id: 4, token: "d", friends: map[int]bool{1: true, 2: true, 3: true}}
+	l.sessions = append(l.sessions, everyone)
+	if request, _ = friendScenario(l, everyone, alice); request.Method != "GET" {
+		t.Errorf("friendScenario() of friend of everyone = %s, want a profile instead", request.Method)
+	}
+}
@@ -0,0 +1,135 @@
+package loadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Scenarios build one request of a logged in user.
+ * Targets of requests are other logged in users
+ */
+
+/* Attempts to find a user who is not a friend yet */
+const friendAttempts = 10
+
+/* State shared by scenarios, used by the scheduler only */
+type load struct {
+	base     string
+	random   *rand.Rand
+	sessions []*session
+	added    map[[2]int]bool // friendships added during the test
+}
+
+type scenario func(l *load, s *session, other *session) (*http.Request, error)
+
+var scenarios = map[string]scenario{
+	"search":  searchScenario,
+	"profile": profileScenario,
+	"friend":  friendScenario,
+	"feed":    feedScenario,
+}
+
+/* Prefixes of common first and last names */
+var searchTerms = []string{"Al", "An", "Dm", "El", "Iv", "Ir", "Ma", "Ni", "Ol", "Pa", "Se", "So", "Vl", "Yu",
+	"Iva", "Pet", "Smi", "Kuz", "Pop", "Vol", "Sok", "Mor", "Nov", "Leb"}
+
+/* Names of known scenarios */
+func Scenarios() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+/* Parse weights of scenarios like search=1,profile=4 */
+func ParseMix(text string) (map[string]float64, error) {
+	mix := make(map[string]float64)
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if _, ok := scenarios[name]; !ok {
+			return nil, fmt.Errorf("unknown scenario %q, expected one of %s", name, strings.Join(Scenarios(), ", "))
+		}
+		weight := 1.0
+		if len(parts) == 2 {
+			var err error
+			if weight, err = strconv.ParseFloat(strings.TrimSpace(parts[1]), 64); err != nil || weight < 0 {
+				return nil, fmt.Errorf("weight of scenario %s must be a non-negative number, got %q", name, parts[1])
+			}
+		}
+		mix[name] = weight
+	}
+	return mix, nil
+}
+
+func searchScenario(l *load, s *session, other *session) (*http.Request, error) {
+	query := url.Values{"search": {searchTerms[l.random.Intn(len(searchTerms))]}}
+	return s.request(http.MethodGet, l.base+"/api/v1/friends/full?"+query.Encode(), nil)
+}
+
+func profileScenario(l *load, s *session, other *session) (*http.Request, error) {
+	return s.request(http.MethodGet, fmt.Sprintf("%s/api/v1/users/%d", l.base, other.id), nil)
+}
+
+/**
+Remove the friendship when it was added during the test,
+otherwise add a user who is not a friend yet. Friendships
+of seed are never added again nor removed, user who is
+friend of everyone looks at a profile instead
+*/
+func friendScenario(l *load, s *session, other *session) (*http.Request, error) {
+	if pair := friendPair(s, other); l.added[pair] {
+		delete(l.added, pair)
+		return s.request(http.MethodDelete, l.base+"/api/v1/friends", relationship(s, other))
+	}
+	for i := 0; i < friendAttempts && (other == s || s.friends[other.id]); i++ {
+		other = l.sessions[l.random.Intn(len(l.sessions))]
+	}
+	if other == s || s.friends[other.id] {
+		return profileScenario(l, s, other)
+	}
+	l.added[friendPair(s, other)] = true
+	return s.request(http.MethodPost, l.base+"/api/v1/friends", relationship(s, other))
+}
+
+func friendPair(s *session, other *session) [2]int {
+	if s.id > other.id {
+		return [2]int{other.id, s.id}
+	}
+	return [2]int{s.id, other.id}
+}
+
+func feedScenario(l *load, s *session, other *session) (*http.Request, error) {
+	return s.request(http.MethodGet, fmt.Sprintf("%s/api/v1/posts?userId=%d&limit=20", l.base, other.id), nil)
+}
+
+func relationship(s *session, other *session) []byte {
+	body, _ := json.Marshal(map[string]int{"userId": s.id, "friendId": other.id})
+	return body
+}
+
+/* Request of the session user with its token */
+func (s *session) request(method string, target string, body []byte) (*http.Request, error) {
+	request, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+s.token)
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	return request, nil
+}
@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/go-sql-driver/mysql"
+	"github.com/sirupsen/logrus"
+	stdlog "log"
+	"net/http"
+	"regexp"
+	"social-network-study/config"
+	"social-network-study/response"
+	"time"
+)
+
+/**
+ * Structured leveled logging, ids of requests
+ * and access log of HTTP requests
+ */
+
+const RequestIdHeader = "X-Request-ID"
+
+type contextKey int
+
+const requestIdKey contextKey = iota
+
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+/* Probes are frequent, they are logged on debug level only */
+var probes = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+func init() {
+	logrus.SetFormatter(&redactingFormatter{formatter: &logrus.TextFormatter{FullTimestamp: true}})
+
+	// Standard logger is used by net/http and libraries, route it through redaction too
+	writer := logrus.StandardLogger().WriterLevel(logrus.WarnLevel)
+	stdlog.SetFlags(0)
+	stdlog.SetOutput(writer)
+	mysql.SetLogger(stdlog.New(writer, "mysql: ", 0))
+}
+
+/* Configure level and format of log output */
+func Init(cfg *config.Config) {
+	level, err := logrus.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		logrus.Fatalf("Unknown log level %s", cfg.Log.Level)
+	}
+	logrus.SetLevel(level)
+
+	switch cfg.Log.Format {
+	case "text":
+		logrus.SetFormatter(&redactingFormatter{formatter: &logrus.TextFormatter{FullTimestamp: true}})
+	case "json":
+		logrus.SetFormatter(&redactingFormatter{formatter: &logrus.JSONFormatter{}})
+	default:
+		logrus.Fatalf("Unknown log format %s", cfg.Log.Format)
+	}
+}
+
+/* Id of request being served, empty outside of requests */
+func RequestId(ctx context.Context) string {
+	requestId, _ := ctx.Value(requestIdKey).(string)
+	return requestId
+}
+
+/* Logger which adds id of request to entries */
+func FromContext(ctx context.Context) *logrus.Entry {
+	if requestId := RequestId(ctx); requestId != "" {
+		return logrus.WithField("request_id", requestId)
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+/**
+Take X-Request-ID of client or generate new one,
+pass it to handlers and response, then write
+access log line when request is served
+*/
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		requestId := request.Header.Get(RequestIdHeader)
+		if !validRequestId.MatchString(requestId) {
+			requestId = newRequestId()
+			request.Header.Set(RequestIdHeader, requestId)
+		}
+		writer.Header().Set(RequestIdHeader, requestId)
+		request = request.WithContext(context.WithValue(request.Context(), requestIdKey, requestId))
+
+		recorder := response.NewRecorder(writer)
+		next.ServeHTTP(recorder, request)
+
+		entry := logrus.WithFields(logrus.Fields{
+			"request_id":  requestId,
+			"method":      request.Method,
+			"path":        request.URL.Path,
+			"status":      recorder.Status,
+			"bytes":       recorder.Bytes,
+			"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"remote":      request.RemoteAddr,
+			"user_agent":  request.UserAgent(),
+		})
+		switch {
+		case recorder.Status >= http.StatusInternalServerError:
+			entry.Error("Request failed")
+		case probes[request.URL.Path]:
+			entry.Debug("Request served")
+		default:
+			entry.Info("Request served")
+		}
+	})
+}
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
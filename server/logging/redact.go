@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"time"
+)
+
+/**
+ * Redaction of passwords, secrets and tokens. It is done by
+ * formatter, so that every entry is redacted whoever logs it
+ */
+
+const redacted = "[REDACTED]"
+
+var secretKey = regexp.MustCompile(`(?i)pass(word)?$|secret|token|authorization|cookie|credential|api_?key`)
+
+var secretValues = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// user:password@tcp(host) of MySQL DSN, password may contain @
+	{regexp.MustCompile(`([^\s:/@]+):\S*@(tcp|unix)\(`), "${1}:" + redacted + "@${2}("},
+	// Authorization header values
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`), "${1} " + redacted},
+	// JSON web tokens anywhere in text
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	// password=..., token: ..., Password:... of printed structs
+	{regexp.MustCompile(`(?i)\b((?:pass(?:word)?|secret|token|api_?key)"?\s*[:=]\s*"?)[^\s",&}]+`), "${1}" + redacted},
+}
+
+/* Replace secrets found in text */
+func Redact(text string) string {
+	for _, secret := range secretValues {
+		text = secret.pattern.ReplaceAllString(text, secret.replacement)
+	}
+	return text
+}
+
+type redactingFormatter struct {
+	formatter logrus.Formatter
+}
+
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	clean := *entry
+	clean.Message = Redact(entry.Message)
+	clean.Data = make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		clean.Data[key] = redactField(key, value)
+	}
+	return f.formatter.Format(&clean)
+}
+
+/* Values of secret fields are dropped, other values are printed and redacted */
+func redactField(key string, value interface{}) interface{} {
+	if secretKey.MatchString(key) {
+		return redacted
+	}
+	switch value := value.(type) {
+	case nil, bool, int, int64, uint64, float64, time.Duration, time.Time:
+		return value
+	case string:
+		return Redact(value)
+	default:
+		return Redact(fmt.Sprintf("%+v", value))
+	}
+}
@@ -1,55 +1,124 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"github.com/gorilla/handlers"
-	"github.com/gorilla/mux"
-	"log"
-	"net/http"
+	log "github.com/sirupsen/logrus"
+	"os"
 	"social-network-study/config"
-	"social-network-study/model/auth"
-	"social-network-study/model/user"
+	"social-network-study/logging"
+	"strings"
 )
 
+/**
+ * Single binary of the application. Every subcommand loads
+ * configuration the same way and accepts the same settings flags
+ */
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string)
+}
+
+var commands = []command{
+	{"serve", "Serve the API and the client application (default)", serveCommand},
+	{"migrate", "Migrate schema of primary database and dialog shards", migrateCommand},
+	{"seed", "Fill database with fake users and friendships", seedCommand},
+	{"user", "Create or delete user, reset password", userCommand},
+	{"token", "Issue authorization token of user for debugging", tokenCommand},
+	{"loadtest", "Load test the REST API with users created by seed", loadtestCommand},
+}
+
+/**
+Run subcommand given by the first argument,
+flags without subcommand are the ones of serve
+*/
 func main() {
-	cfg := config.InitConfig()
-	log.Printf("%+v", cfg)
+	args := os.Args[1:]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		serveCommand(args)
+		return
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			cmd.run(args[1:])
+			return
+		}
+	}
+	if args[0] != "help" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun '%s <command> -h' for flags of command\n", os.Args[0])
+}
+
+/* Flags of subcommand, synopsis follows its name in usage */
+func newFlagSet(name string, synopsis string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] %s\n", os.Args[0], name, synopsis)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+/**
+Load configuration of subcommand and init logging.
+Nil is returned when configuration was only printed
+*/
+func loadConfig(flags *flag.FlagSet, args []string) *config.Config {
+	cfg, err := config.InitConfig(flags, args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("Cannot print configuration... %v", err)
+		}
+		return nil
+	}
+	logging.Init(cfg)
+	return cfg
+}
+
+/**
+Connect databases and dialog shards, schema must
+be up to date after optional migration
+*/
+func connect(cfg *config.Config, migrate bool) {
 	config.ConnectDataBase(cfg)
-	defer config.CloseDataBase()
-
-	router := mux.NewRouter()
-	allowHeaders := []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "If-Modified-Since"}
-	headers := handlers.AllowedHeaders(allowHeaders)
-	methods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
-	origins := handlers.AllowedOrigins([]string{"*"})
-	credentials := handlers.AllowCredentials()
-	exposedHeaders := handlers.ExposedHeaders(allowHeaders)
-
-	apiRoot := router.PathPrefix("/api/v1").Subrouter()
-	apiRoot.HandleFunc("/singin", user.SingIn).Methods("POST")
-	apiRoot.HandleFunc("/singup", user.SingUp).Methods("POST")
-	apiRoot.HandleFunc("/singup/{login}", user.GetCheckLogin).Methods("GET")
-
-
-	api := router.PathPrefix("/api/v1").Subrouter()
-	api.Use(auth.Secure)
-	api.HandleFunc("/current-user", user.GetCurrentUser).Methods("GET")
-	api.HandleFunc("/users/{id}", user.GetUser).Methods("GET")
-	api.HandleFunc("/users/{id}", user.DeleteUser).Methods("DELETE")
-	api.HandleFunc("/users", user.UpdateUser).Methods("PUT")
-	api.HandleFunc("/friends/unknown", user.GetUnknownUsers).Methods("GET")
-	api.HandleFunc("/friends/full", user.GetFullUsers).Methods("GET")
-	api.HandleFunc("/friends", user.GetFriends).Methods("GET")
-	api.HandleFunc("/friends", user.PostAddFriend).Methods("POST")
-	api.HandleFunc("/friends", user.DeleteFriend).Methods("DELETE")
-
-	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./html/static/"))))
-
-	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r,"./html/index.html")
-	})
-
-	port := cfg.Server.Port
-	log.Printf("Server was started on port: %s", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), handlers.CORS(headers, methods, origins, credentials, exposedHeaders)(router)))
-}
\ No newline at end of file
+	config.ConnectShards(cfg)
+	if migrate {
+		if err := config.MigrateUp(); err != nil {
+			log.Fatalf("Cannot migrate database... %v", err)
+		}
+	}
+	if err := config.CheckSchema(context.Background()); err != nil {
+		log.Fatalf("Schema is behind migrations, run migrate up... %v", err)
+	}
+}
+
+func disconnect() {
+	config.CloseShards()
+	config.CloseDataBase()
+}
+
+/* Arguments following flags must be given exactly */
+func requireArgs(flags *flag.FlagSet, count int) []string {
+	if flags.NArg() != count {
+		flags.Usage()
+		os.Exit(2)
+	}
+	return flags.Args()
+}
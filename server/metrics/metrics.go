@@ -0,0 +1,151 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"social-network-study/config"
+	"social-network-study/response"
+	"strconv"
+	"time"
+)
+
+/**
+ * Prometheus metrics of HTTP handlers, database pools
+ * and repository methods. Go runtime and process metrics
+ * come from the default registry
+ */
+
+const namespace = "social_network"
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route template, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	repositoryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_duration_seconds",
+		Help:      "Latency of repository methods including all of their queries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+)
+
+func init() {
+	prometheus.MustRegister(requestsTotal, requestDuration, repositoryDuration, newPoolCollector())
+}
+
+/* Handler exposing metrics for scraping */
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+/**
+Measure requests by mux route template,
+so that path parameters do not blow up labels
+*/
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := response.NewRecorder(writer)
+		next.ServeHTTP(recorder, request)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		code := strconv.Itoa(recorder.Status)
+		requestsTotal.WithLabelValues(route, request.Method, code).Inc()
+		requestDuration.WithLabelValues(route, request.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+/**
+Measure latency of repository method, use as
+defer metrics.Measure("user.FetchUserById")()
+*/
+func Measure(method string) func() {
+	start := time.Now()
+	return func() {
+		repositoryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+
+/* Collects sql.DB.Stats() of every host and shard at scrape time */
+type poolCollector struct {
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	maxOpen           *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+func newPoolCollector() *poolCollector {
+	labels := []string{"pool", "host"}
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, labels, nil)
+	}
+	return &poolCollector{
+		open:              desc("open_connections", "Number of established connections, in use and idle."),
+		inUse:             desc("in_use_connections", "Number of connections currently in use."),
+		idle:              desc("idle_connections", "Number of idle connections."),
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections."),
+		waitCount:         desc("wait_count_total", "Number of connections waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "Time blocked waiting for a new connection."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Number of connections closed due to max idle count."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Number of connections closed due to max lifetime."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.maxOpen
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for host, db := range config.DataBasesByHost() {
+		c.collect(ch, db, "main", host)
+	}
+	if config.ShardsConfigured() {
+		for _, name := range config.ShardNames() {
+			if db, err := config.ShardDataBase(name); err == nil {
+				c.collect(ch, db, name, config.ShardHost(name))
+			}
+		}
+	}
+}
+
+func (c *poolCollector) collect(ch chan<- prometheus.Metric, db *sql.DB, pool string, host string) {
+	stats := db.Stats()
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), pool, host)
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), pool, host)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang-migrate/migrate/v4"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"social-network-study/config"
+	"strconv"
+	"text/tabwriter"
+)
+
+const allTargets = "all"
+
+/**
+Subcommand migrating schema of primary host and dialog shards:
+  server migrate [flags] up            apply every new migration
+  server migrate [flags] down N        revert N migrations
+  server migrate [flags] goto V        migrate up or down to version V
+  server migrate [flags] force V       mark version V as applied and clean
+  server migrate [flags] status        print applied and latest versions
+Replicas are never migrated, they receive schema by replication
+*/
+func migrateCommand(args []string) {
+	flags := newFlagSet("migrate", "up | down N | goto V | force V | status")
+	target := flags.String("target", allTargets, fmt.Sprintf("Database to migrate: %s, name of dialog shard or %s", config.MainTarget, allTargets))
+	cfg := loadConfig(flags, args)
+	if cfg == nil {
+		return
+	}
+	action := flags.Args()
+	if len(action) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	config.ConnectPrimary(cfg)
+	config.ConnectShards(cfg)
+	defer disconnect()
+
+	targets := config.MigrationTargets()
+	if *target != allTargets {
+		targets = []string{*target}
+	}
+
+	var err error
+	switch action[0] {
+	case "up":
+		err = eachTarget(targets, func(m *migrate.Migrate) error {
+			return m.Up()
+		})
+	case "down":
+		var steps int
+		if steps, err = actionNumber(action); err == nil && steps <= 0 {
+			err = fmt.Errorf("number of migrations to revert must be positive")
+		}
+		if err == nil {
+			err = singleTarget(*target, targets, func(m *migrate.Migrate) error {
+				return m.Steps(-steps)
+			})
+		}
+	case "goto":
+		var version int
+		if version, err = actionNumber(action); err == nil {
+			err = singleTarget(*target, targets, func(m *migrate.Migrate) error {
+				return m.Migrate(uint(version))
+			})
+		}
+	case "force":
+		var version int
+		if version, err = actionNumber(action); err == nil {
+			err = singleTarget(*target, targets, func(m *migrate.Migrate) error {
+				return m.Force(version)
+			})
+		}
+	case "status":
+		err = printStatus(targets)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Migration failed... %v", err)
+	}
+}
+
+/* Version or count following the action */
+func actionNumber(action []string) (int, error) {
+	if len(action) != 2 {
+		return 0, fmt.Errorf("%s expects one number", action[0])
+	}
+	number, err := strconv.Atoi(action[1])
+	if err != nil {
+		return 0, fmt.Errorf("%s expects a number, got %q", action[0], action[1])
+	}
+	return number, nil
+}
+
+/* Commands moving to exact version are applied to a chosen database only */
+func singleTarget(target string, targets []string, apply func(m *migrate.Migrate) error) error {
+	if target == allTargets {
+		return fmt.Errorf("choose database with -target, versions of main database and shards differ")
+	}
+	return eachTarget(targets, apply)
+}
+
+func eachTarget(targets []string, apply func(m *migrate.Migrate) error) error {
+	for _, target := range targets {
+		if err := migrateTarget(target, apply); err != nil {
+			return fmt.Errorf("%s: %v", target, err)
+		}
+	}
+	return nil
+}
+
+func migrateTarget(target string, apply func(m *migrate.Migrate) error) error {
+	m, err := config.NewMigration(target)
+	if err != nil {
+		return err
+	}
+	defer config.CloseMigration(m)
+	err = apply(m)
+	if err == migrate.ErrNoChange {
+		log.WithField("target", target).Info("Schema is up to date")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	version, dirty, _ := m.Version()
+	log.WithFields(log.Fields{"target": target, "version": version, "dirty": dirty}).Info("Schema migrated")
+	return nil
+}
+
+func printStatus(targets []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TARGET\tVERSION\tLATEST\tSTATE")
+	for _, target := range targets {
+		status, err := config.TargetSchemaStatus(context.Background(), target)
+		if err != nil {
+			return err
+		}
+		state := "ok"
+		if err := status.Err(); err != nil {
+			state = err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", status.Target, status.Version, status.Latest, state)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,5 @@
+DELETE FROM counter_events WHERE event_key NOT LIKE 'id:%';
+ALTER TABLE counter_events ADD COLUMN event_id BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER shard;
+UPDATE counter_events SET event_id = CAST(SUBSTRING(event_key, 4) AS UNSIGNED);
+ALTER TABLE counter_events DROP PRIMARY KEY, DROP COLUMN event_key, ALTER event_id DROP DEFAULT, ADD PRIMARY KEY (shard, event_id);
+ALTER TABLE outbox DROP INDEX idx_outbox_event_key, DROP COLUMN event_key;
\ No newline at end of file
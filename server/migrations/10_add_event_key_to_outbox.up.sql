@@ -0,0 +1,6 @@
+ALTER TABLE outbox ADD COLUMN event_key VARCHAR(40) NULL AFTER id;
+UPDATE outbox SET event_key = CONCAT('id:', id);
+ALTER TABLE outbox MODIFY event_key VARCHAR(40) NOT NULL, ADD UNIQUE INDEX idx_outbox_event_key (event_key);
+ALTER TABLE counter_events ADD COLUMN event_key VARCHAR(40) NULL AFTER shard;
+UPDATE counter_events SET event_key = CONCAT('id:', event_id);
+ALTER TABLE counter_events DROP PRIMARY KEY, DROP COLUMN event_id, MODIFY event_key VARCHAR(40) NOT NULL, ADD PRIMARY KEY (shard, event_key);
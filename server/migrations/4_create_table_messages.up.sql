@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    from_user_id INTEGER UNSIGNED NOT NULL,
+    to_user_id INTEGER UNSIGNED NOT NULL,
+    text TEXT NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT message_from_fk FOREIGN KEY (from_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT message_to_fk FOREIGN KEY (to_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    INDEX idx_messages_from_to (from_user_id, to_user_id, id),
+    INDEX idx_messages_to_read (to_user_id, is_read)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
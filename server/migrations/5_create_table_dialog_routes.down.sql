@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS dialog_routes;
+DROP INDEX idx_messages_dialog ON messages;
+ALTER TABLE messages DROP COLUMN dialog_key;
\ No newline at end of file
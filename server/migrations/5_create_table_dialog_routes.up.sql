@@ -0,0 +1,10 @@
+ALTER TABLE messages ADD COLUMN dialog_key VARCHAR(32) NOT NULL DEFAULT '' AFTER id;
+UPDATE messages SET dialog_key = CONCAT(LEAST(from_user_id, to_user_id), ':', GREATEST(from_user_id, to_user_id));
+CREATE INDEX idx_messages_dialog ON messages(dialog_key, id);
+CREATE TABLE IF NOT EXISTS dialog_routes (
+    dialog_key VARCHAR(32) NOT NULL PRIMARY KEY,
+    shard VARCHAR(50) NOT NULL,
+    target VARCHAR(50),
+    status ENUM('active', 'moving', 'locked') NOT NULL DEFAULT 'active',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS counter_events;
+DROP TABLE IF EXISTS counters;
+DROP TABLE IF EXISTS outbox;
\ No newline at end of file
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    user_id INTEGER UNSIGNED NOT NULL,
+    companion_id INTEGER UNSIGNED NOT NULL,
+    delta INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB;
+CREATE TABLE IF NOT EXISTS counters (
+    user_id INTEGER UNSIGNED NOT NULL,
+    companion_id INTEGER UNSIGNED NOT NULL,
+    unread INTEGER NOT NULL DEFAULT 0,
+    CONSTRAINT counter_user_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    PRIMARY KEY(user_id, companion_id)
+) ENGINE=InnoDB;
+CREATE TABLE IF NOT EXISTS counter_events (
+    shard VARCHAR(50) NOT NULL,
+    event_id BIGINT UNSIGNED NOT NULL,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY(shard, event_id),
+    INDEX idx_counter_events_applied_at (applied_at)
+) ENGINE=InnoDB;
+INSERT INTO counters(user_id, companion_id, unread)
+SELECT to_user_id, from_user_id, COUNT(*) FROM messages WHERE is_read = FALSE GROUP BY to_user_id, from_user_id;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS presence;
\ No newline at end of file
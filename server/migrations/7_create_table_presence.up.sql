@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS presence (
+    user_id INTEGER UNSIGNED NOT NULL PRIMARY KEY,
+    last_seen TIMESTAMP NULL,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT presence_user_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB;
\ No newline at end of file
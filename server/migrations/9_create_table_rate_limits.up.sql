@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS rate_limits (
+    bucket VARCHAR(191) NOT NULL PRIMARY KEY,
+    tokens DOUBLE NOT NULL,
+    updated_ns BIGINT NOT NULL,
+    full_ns BIGINT NOT NULL,
+    INDEX idx_rate_limits_full (full_ns)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
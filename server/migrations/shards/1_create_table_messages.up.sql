@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS messages (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    dialog_key VARCHAR(32) NOT NULL,
+    from_user_id INTEGER UNSIGNED NOT NULL,
+    to_user_id INTEGER UNSIGNED NOT NULL,
+    text TEXT NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (dialog_key, id),
+    INDEX idx_messages_id (id),
+    INDEX idx_messages_from (from_user_id),
+    INDEX idx_messages_to_read (to_user_id, is_read)
+) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
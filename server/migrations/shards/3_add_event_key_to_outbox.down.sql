@@ -0,0 +1 @@
+ALTER TABLE outbox DROP INDEX idx_outbox_event_key, DROP COLUMN event_key;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE outbox ADD COLUMN event_key VARCHAR(40) NULL AFTER id;
+UPDATE outbox SET event_key = CONCAT('id:', id);
+ALTER TABLE outbox MODIFY event_key VARCHAR(40) NOT NULL, ADD UNIQUE INDEX idx_outbox_event_key (event_key);
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+/**
+ * Session in cookies, an alternative to bearer tokens kept
+ * by clients. The access token is in HttpOnly cookie, so scripts
+ * cannot read it, and state-changing requests must repeat the
+ * CSRF cookie in X-CSRF-Token header (double submit)
+ */
+
+const (
+	SessionCookie = "session"
+	RefreshCookie = "refresh_token"
+	CsrfCookie    = "csrf_token"
+	CsrfHeader    = "X-CSRF-Token"
+)
+
+/* Only refresh of session needs the refresh token */
+const refreshCookiePath = "/api/v2/sessions"
+
+var cookies = false
+var cookieSecure = true
+var cookieSameSite = http.SameSiteStrictMode
+
+var sameSiteModes = map[string]http.SameSite{
+	"strict": http.SameSiteStrictMode,
+	"lax":    http.SameSiteLaxMode,
+	"none":   http.SameSiteNoneMode,
+}
+
+/* Whether sign in also starts session in cookies */
+func CookiesEnabled() bool {
+	return cookies
+}
+
+/* Set cookies of session with new CSRF token */
+func SetSessionCookies(w http.ResponseWriter, accessToken string, refreshToken string) error {
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		return err
+	}
+	http.SetCookie(w, newCookie(SessionCookie, accessToken, "/", accessTokenTtl, true))
+	http.SetCookie(w, newCookie(RefreshCookie, refreshToken, refreshCookiePath, refreshTokenTtl, true))
+	http.SetCookie(w, newCookie(CsrfCookie, base64.RawURLEncoding.EncodeToString(csrf), "/", refreshTokenTtl, false))
+	return nil
+}
+
+/* Expire cookies of session */
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, newCookie(SessionCookie, "", "/", -1, true))
+	http.SetCookie(w, newCookie(RefreshCookie, "", refreshCookiePath, -1, true))
+	http.SetCookie(w, newCookie(CsrfCookie, "", "/", -1, false))
+}
+
+func newCookie(name string, value string, path string, ttl time.Duration, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		HttpOnly: httpOnly,
+		Secure:   cookieSecure,
+		SameSite: cookieSameSite,
+	}
+	if ttl < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(ttl.Seconds())
+	}
+	return cookie
+}
+
+/* Token of session cookie, empty without the cookie or when cookies are disabled */
+func CookieToken(r *http.Request, name string) string {
+	if !cookies {
+		return ""
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+/* State-changing requests must repeat the CSRF cookie in the header */
+func CheckCsrf(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+	cookie, err := r.Cookie(CsrfCookie)
+	if err != nil || cookie.Value == "" {
+		return errors.New("CSRF cookie must be present")
+	}
+	header := r.Header.Get(CsrfHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errors.New("CSRF token does not match")
+	}
+	return nil
+}
+
+/* Origin of request is the host itself, browsers send it with WebSocket */
+func SameOrigin(r *http.Request) bool {
+	origin, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && origin.Host != "" && origin.Host == r.Host
+}
@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCsrf(t *testing.T) {
+	request := func(method string, cookie string, header string) *http.Request {
+		r := httptest.NewRequest(method, "/api/v2/posts", nil)
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: CsrfCookie, Value: cookie})
+		}
+		if header != "" {
+			r.Header.Set(CsrfHeader, header)
+		}
+		return r
+	}
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodOptions} {
+		if err := CheckCsrf(request(method, "", "")); err != nil {
+			t.Errorf("%s without token error = %v, safe methods need none", method, err)
+		}
+	}
+	if err := CheckCsrf(request(http.MethodPost, "token", "token")); err != nil {
+		t.Errorf("matching token error = %v", err)
+	}
+	// A forged form carries the cookie of the browser but cannot set the header
+	for name, r := range map[string]*http.Request{
+		"no header":       request(http.MethodPost, "token", ""),
+		"no cookie":       request(http.MethodDelete, "", "token"),
+		"prefix of token": request(http.MethodPut, "token", "tok"),
+		"other token":     request(http.MethodPatch, "token", "tokem"),
+	} {
+		if err := CheckCsrf(r); err == nil {
+			t.Errorf("%s: request must be rejected", name)
+		}
+	}
+}
+
+func TestSessionCookies(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	if err := SetSessionCookies(recorder, "access", "refresh"); err != nil {
+		t.Fatal(err)
+	}
+	set := make(map[string]*http.Cookie)
+	for _, cookie := range recorder.Result().Cookies() {
+		set[cookie.Name] = cookie
+	}
+	if session := set[SessionCookie]; session == nil || !session.HttpOnly || session.Path != "/" || session.Value != "access" {
+		t.Errorf("session cookie = %+v, want HttpOnly of the whole site", session)
+	}
+	if refresh := set[RefreshCookie]; refresh == nil || !refresh.HttpOnly || refresh.Path != refreshCookiePath {
+		t.Errorf("refresh cookie = %+v, want HttpOnly sent to refresh of session only", refresh)
+	}
+	csrf := set[CsrfCookie]
+	if csrf == nil || csrf.HttpOnly || len(csrf.Value) < 32 {
+		t.Fatalf("CSRF cookie = %+v, want random token readable by scripts", csrf)
+	}
+	for _, cookie := range set {
+		if !cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+			t.Errorf("cookie %s is not Secure and SameSite=Strict by default", cookie.Name)
+		}
+	}
+
+	again := httptest.NewRecorder()
+	SetSessionCookies(again, "access", "refresh")
+	for _, cookie := range again.Result().Cookies() {
+		if cookie.Name == CsrfCookie && cookie.Value == csrf.Value {
+			t.Error("every session must get its own CSRF token")
+		}
+	}
+}
+
+func TestCookieTokenNeedsCookiesEnabled(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "/api/v2/users/me", nil)
+	request.AddCookie(&http.Cookie{Name: SessionCookie, Value: "access"})
+	if token := CookieToken(request, SessionCookie); token != "" {
+		t.Errorf("CookieToken() with cookies disabled = %q", token)
+	}
+	cookies = true
+	t.Cleanup(func() { cookies = false })
+	if token := CookieToken(request, SessionCookie); token != "access" {
+		t.Errorf("CookieToken() = %q, want access", token)
+	}
+	if token := CookieToken(request, RefreshCookie); token != "" {
+		t.Errorf("CookieToken() of missing cookie = %q", token)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	for origin, want := range map[string]bool{
+		"https://example.com":      true,
+		"http://example.com":       true,
+		"https://example.com:8443": false,
+		"https://evil.com":         false,
+		"null":                     false,
+		"":                         false,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "https://example.com/api/v2/presence", nil)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		if got := SameOrigin(request); got != want {
+			t.Errorf("SameOrigin() of %q = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestSecureRejectsCookieWithoutCsrf(t *testing.T) {
+	cookies = true
+	t.Cleanup(func() { cookies = false })
+	request := httptest.NewRequest(http.MethodPost, "/api/v2/posts", nil)
+	request.AddCookie(&http.Cookie{Name: SessionCookie, Value: "access"})
+	request.AddCookie(&http.Cookie{Name: CsrfCookie, Value: "csrf"})
+
+	recorder := httptest.NewRecorder()
+	Secure(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler called")
+	})).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", recorder.Code, http.StatusForbidden)
+	}
+}
@@ -2,21 +2,45 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 )
 
+const bearerPrefix = "Bearer "
+
+/* Accept bearer token or, when it is absent, session cookie */
 func Secure(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
-		tokenString := request.Header.Get("Authorization")
-		if tokenString != "" {
-			valid, err := ValidateToken(tokenString[7:]) //7 corresponds to "Bearer "
-			if err != nil {
-				http.Error(writer, err.Error(), http.StatusBadRequest)
-			}
-			if valid {
-				next.ServeHTTP(writer, request)
+		if session := CookieToken(request, SessionCookie); request.Header.Get("Authorization") == "" && session != "" {
+			if err := CheckCsrf(request); err != nil {
+				http.Error(writer, err.Error(), http.StatusForbidden)
 				return
 			}
+			// Handlers read the token of the header
+			request.Header.Set("Authorization", bearerPrefix+session)
+		}
+		tokenString := BearerToken(request)
+		if tokenString == "" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		valid, err := ValidateToken(tokenString)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
 		}
-		writer.WriteHeader(http.StatusUnauthorized)
+		if !valid {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(writer, request)
 	})
 }
+
+/* Token of Authorization header of bearer scheme, empty for any other header */
+func BearerToken(request *http.Request) string {
+	header := request.Header.Get("Authorization")
+	if !strings.HasPrefix(header, bearerPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(header, bearerPrefix)
+}
@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	for header, want := range map[string]string{
+		"Bearer abc":                     "abc",
+		"":                               "",
+		"abc":                            "",
+		"Basic YWxhZGRpbjpvcGVuc2VzYW1l": "",
+		"Bearerabc":                      "",
+		"bearer abc":                     "",
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/api/v2/users/me", nil)
+		request.Header.Set("Authorization", header)
+		if got := BearerToken(request); got != want {
+			t.Errorf("BearerToken() of %q = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestSecure(t *testing.T) {
+	access, err := CreateToken(1, "ivan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := CreateRefreshToken("ivan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"access token", bearerPrefix + access, http.StatusOK},
+		{"no header", "", http.StatusUnauthorized},
+		{"other scheme", "Basic YWxhZGRpbjpvcGVuc2VzYW1l", http.StatusUnauthorized},
+		{"empty token", bearerPrefix, http.StatusUnauthorized},
+		{"token without scheme", access, http.StatusUnauthorized},
+		{"malformed token", bearerPrefix + "not-a-token", http.StatusBadRequest},
+		{"refresh token", bearerPrefix + refresh, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/api/v2/users/me", nil)
+		if test.header != "" {
+			request.Header.Set("Authorization", test.header)
+		}
+		if code := serveSecure(request); code != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, code, test.want)
+		}
+	}
+}
+
+func TestSecureWithSessionCookie(t *testing.T) {
+	cookies = true
+	t.Cleanup(func() { cookies = false })
+	access, err := CreateToken(1, "ivan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(method string, csrf string) *http.Request {
+		r := httptest.NewRequest(method, "/api/v2/posts", nil)
+		r.AddCookie(&http.Cookie{Name: SessionCookie, Value: access})
+		r.AddCookie(&http.Cookie{Name: CsrfCookie, Value: "csrf"})
+		if csrf != "" {
+			r.Header.Set(CsrfHeader, csrf)
+		}
+		return r
+	}
+	if code := serveSecure(request(http.MethodGet, "")); code != http.StatusOK {
+		t.Errorf("GET with session cookie = %d", code)
+	}
+	if code := serveSecure(request(http.MethodPost, "csrf")); code != http.StatusOK {
+		t.Errorf("POST with session cookie and CSRF header = %d", code)
+	}
+	// Header of the client wins, forged requests cannot set it
+	withHeader := request(http.MethodPost, "")
+	withHeader.Header.Set("Authorization", bearerPrefix+"not-a-token")
+	if code := serveSecure(withHeader); code != http.StatusBadRequest {
+		t.Errorf("POST with session cookie and bearer token = %d, want token of header checked", code)
+	}
+}
+
+/* Status of request passed through Secure to a handler answering 200 */
+func serveSecure(request *http.Request) int {
+	recorder := httptest.NewRecorder()
+	Secure(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(recorder, request)
+	return recorder.Code
+}
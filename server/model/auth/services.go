@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"social-network-study/config"
+	"time"
 )
 
 /**
@@ -12,6 +14,31 @@ import (
 
 var jwtSecret = []byte("D6E6BEAABF9BD6992886D3F176C8A62A56F91FA63A6FB5BA257E5F051975391F")
 
+/* Refresh tokens are only exchanged for new tokens, they do not authorize requests */
+const refreshTokenType = "refresh"
+
+var accessTokenTtl = 24 * time.Hour
+var refreshTokenTtl = 30 * 24 * time.Hour
+
+func Init(cfg *config.Config) {
+	if cfg.Auth.AccessTokenTtl > 0 {
+		accessTokenTtl = cfg.Auth.AccessTokenTtl
+	}
+	if cfg.Auth.RefreshTokenTtl > 0 {
+		refreshTokenTtl = cfg.Auth.RefreshTokenTtl
+	}
+	cookies = cfg.Auth.Cookies
+	cookieSecure = cfg.Auth.CookieSecure
+	if mode, ok := sameSiteModes[cfg.Auth.CookieSameSite]; ok {
+		cookieSameSite = mode
+	}
+}
+
+/* Lifetime of access tokens */
+func AccessTokenTtl() time.Duration {
+	return accessTokenTtl
+}
+
 /* Validate Token */
 func ValidateToken(tokenString string) (bool, error) {
 	if tokenString == "" {
@@ -24,18 +51,23 @@ func ValidateToken(tokenString string) (bool, error) {
 		}
 		return jwtSecret, nil
 	})
+	if token == nil {
+		return false, errors.New("invalid authorization token")
+	}
 
-	if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["typ"] != refreshTokenType {
 		return true, nil
 	} else {
 		return false, errors.New("invalid authorization token")
 	}
 }
 
-/* Generate token by SingIn and Password */
-func CreateToken(login string) (string, error) {
+/* Generate access token by SingIn and Password */
+func CreateToken(id int, login string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"login":    login,
+		"login": login,
+		"uid":   id,
+		"exp":   time.Now().Add(accessTokenTtl).Unix(),
 	})
 	tokenString, err := token.SignedString(jwtSecret)
 	if err != nil {
@@ -44,6 +76,61 @@ func CreateToken(login string) (string, error) {
 	return tokenString, nil
 }
 
+/* Generate refresh token, which is exchanged for new access token */
+func CreateRefreshToken(login string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"login": login,
+		"typ":   refreshTokenType,
+		"exp":   time.Now().Add(refreshTokenTtl).Unix(),
+	})
+	return token.SignedString(jwtSecret)
+}
+
+/* Get login by refresh token, checking signature and expiry */
+func GetLoginByRefreshToken(tokenString string) (string, error) {
+	if tokenString == "" {
+		return "", errors.New("refresh token must be present")
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("there was an error")
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid || claims["typ"] != refreshTokenType {
+		return "", errors.New("invalid refresh token")
+	}
+	login, ok := claims["login"].(string)
+	if !ok {
+		return "", errors.New("invalid refresh token")
+	}
+	return login, nil
+}
+
+/**
+Get id of user by valid access token. Tokens
+issued before ids were added to them have none
+*/
+func GetUserIdByToken(tokenString string) (int, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("there was an error")
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid || claims["typ"] == refreshTokenType {
+		return 0, errors.New("invalid authorization token")
+	}
+	// Numbers of claims are decoded as float64
+	id, ok := claims["uid"].(float64)
+	if !ok || id <= 0 {
+		return 0, errors.New("authorization token has no user id")
+	}
+	return int(id), nil
+}
+
 /* Get string login by token */
 func GetLoginByToken(tokenString string) (string, error) {
 	if tokenString == "" {
@@ -0,0 +1,29 @@
+package counter
+
+import (
+	"encoding/json"
+	"net/http"
+	"social-network-study/model/user"
+)
+
+/* Get unread counters of current user */
+func GetCounters(w http.ResponseWriter, r *http.Request) {
+	currentUser, err := user.GetCurrentPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counters, err := FetchCounters(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(counters)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
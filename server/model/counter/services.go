@@ -0,0 +1,497 @@
+package counter
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"social-network-study/config"
+	"social-network-study/metrics"
+	"social-network-study/model/dialog"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Service for working with unread Counters.
+ * Messages store changes of counters in the outbox of their
+ * shard within the same transaction, the relay applies them
+ * exactly once by their key and reconciliation recomputes
+ * counters from messages in case they drifted anyway.
+ * Counters are changed and compared on the primary,
+ * only reading them for Users may lag behind
+ */
+
+const (
+	relayBatchSize  = 500
+	counterLock     = "social_network_counters"
+	eventsRetention = 24 * time.Hour
+)
+
+var errLocked = errors.New("counters are locked by another worker")
+
+type DialogCounter struct {
+	CompanionId int `json:"companionId"`
+	Unread      int `json:"unread"`
+}
+
+type Counters struct {
+	Total   int              `json:"total"`
+	Dialogs []*DialogCounter `json:"dialogs"`
+}
+
+type event struct {
+	Key         string
+	UserId      int
+	CompanionId int
+	Delta       int
+}
+
+type pair struct {
+	UserId      int
+	CompanionId int
+}
+
+type snapshot struct {
+	Counts map[string]map[pair]int
+	Events []*event
+}
+
+var stop chan struct{}
+var done chan struct{}
+
+var relayMutex sync.Mutex
+var relayInterval time.Duration
+var lastRelay time.Time
+
+/* Get unread counters of User */
+func FetchCounters(id int) (*Counters, error) {
+	defer metrics.Measure("counter.FetchCounters")()
+	db := config.DataBase()
+	rows, err := db.Query("SELECT companion_id, unread FROM counters WHERE user_id=? AND unread > 0 ORDER BY companion_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := &Counters{Dialogs: make([]*DialogCounter, 0)}
+	for rows.Next() {
+		counter := new(DialogCounter)
+		err = rows.Scan(&counter.CompanionId, &counter.Unread)
+		if err != nil {
+			return nil, err
+		}
+		counters.Total += counter.Unread
+		counters.Dialogs = append(counters.Dialogs, counter)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+/**
+Start relay and reconciliation in background,
+reconciliation is disabled with zero interval
+*/
+func Start(cfg *config.Config) {
+	relayMutex.Lock()
+	relayInterval = cfg.Counters.RelayInterval
+	if relayInterval <= 0 {
+		relayInterval = time.Second
+	}
+	lastRelay = time.Now()
+	relayMutex.Unlock()
+	reconcileInterval := cfg.Counters.ReconcileInterval
+	stop = make(chan struct{})
+	done = make(chan struct{})
+
+	go func() {
+		defer close(done)
+		relayTicker := time.NewTicker(relayInterval)
+		defer relayTicker.Stop()
+		var reconcileTick <-chan time.Time
+		if reconcileInterval > 0 {
+			reconcileTicker := time.NewTicker(reconcileInterval)
+			defer reconcileTicker.Stop()
+			reconcileTick = reconcileTicker.C
+		}
+		for {
+			select {
+			case <-stop:
+				return
+			case <-relayTicker.C:
+				err := Relay()
+				if err != nil && err != errLocked {
+					log.WithError(err).Error("Counters relay failed")
+				} else {
+					relayMutex.Lock()
+					lastRelay = time.Now()
+					relayMutex.Unlock()
+				}
+			case <-reconcileTick:
+				fixed, err := Reconcile()
+				if err != nil && err != errLocked {
+					log.WithError(err).Error("Counters reconciliation failed")
+				} else if fixed > 0 {
+					log.WithField("fixed", fixed).Warn("Counters reconciliation fixed counters")
+				}
+			}
+		}
+	}()
+}
+
+/**
+Check that relay keeps up, it is stalled when
+it has not succeeded for ten relay intervals
+*/
+func Status() (time.Time, error) {
+	relayMutex.Lock()
+	defer relayMutex.Unlock()
+	if done == nil {
+		return lastRelay, errors.New("relay is not started")
+	}
+	if time.Since(lastRelay) > 10*relayInterval {
+		return lastRelay, fmt.Errorf("relay has not succeeded since %s", lastRelay.Format(time.RFC3339))
+	}
+	return lastRelay, nil
+}
+
+/* Stop background workers and wait for them */
+func Stop() {
+	if done == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+/**
+Run function holding the counters lock,
+so that only one worker of all instances
+changes counters at a time
+*/
+func withLock(f func() error) error {
+	ctx := context.Background()
+	conn, err := config.PrimaryDataBase().Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", counterLock).Scan(&locked)
+	if err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return errLocked
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", counterLock)
+	return f()
+}
+
+/* Apply events from outboxes of all shards */
+func Relay() error {
+	defer metrics.Measure("counter.Relay")()
+	return withLock(func() error {
+		for _, shard := range config.ShardNames() {
+			for {
+				count, err := relayShard(shard)
+				if err != nil {
+					return err
+				}
+				if count < relayBatchSize {
+					break
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func relayShard(shard string) (int, error) {
+	events, err := fetchEvents(shard)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	db := config.PrimaryDataBase()
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	keys := make([]interface{}, 0, len(events))
+	for _, e := range events {
+		keys = append(keys, e.Key)
+		exec, err := tx.Exec("INSERT IGNORE INTO counter_events(shard, event_key) VALUES (?, ?)", shard, e.Key)
+		if err != nil {
+			return 0, err
+		}
+		applied, err := exec.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if applied == 0 {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO counters(user_id, companion_id, unread) VALUES (?, ?, ?)
+								 ON DUPLICATE KEY UPDATE unread = unread + VALUES(unread)`,
+			e.UserId,
+			e.CompanionId,
+			e.Delta,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(events), deleteEvents(shard, keys)
+}
+
+func fetchEvents(shard string) ([]*event, error) {
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT event_key, user_id, companion_id, delta FROM outbox ORDER BY id LIMIT ?", relayBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]*event, 0)
+	for rows.Next() {
+		e := new(event)
+		err = rows.Scan(&e.Key, &e.UserId, &e.CompanionId, &e.Delta)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func deleteEvents(shard string, keys []interface{}) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("DELETE FROM outbox WHERE event_key IN (%s)", placeholders), keys...)
+	return err
+}
+
+/**
+Recompute counters from messages, the source of truth.
+Each shard is read from one snapshot, so pending outbox
+events seen there are already part of the counts of
+dialogs the shard owns and are marked as applied.
+Dialogs being moved are skipped, their events are left
+to the relay. Returns number of fixed counters
+*/
+func Reconcile() (int, error) {
+	defer metrics.Measure("counter.Reconcile")()
+	fixed := 0
+	err := withLock(func() error {
+		snapshots := make(map[string]*snapshot)
+		keys := make([]string, 0)
+		for _, shard := range config.ShardNames() {
+			s, err := snapshotShard(shard)
+			if err != nil {
+				return err
+			}
+			snapshots[shard] = s
+			for key := range s.Counts {
+				keys = append(keys, key)
+			}
+			for _, e := range s.Events {
+				keys = append(keys, dialog.Key(e.UserId, e.CompanionId))
+			}
+		}
+
+		current, err := fetchAllCounters()
+		if err != nil {
+			return err
+		}
+		for p := range current {
+			keys = append(keys, dialog.Key(p.UserId, p.CompanionId))
+		}
+		owners, err := dialog.Owners(keys)
+		if err != nil {
+			return err
+		}
+
+		counts := make(map[pair]int)
+		for shard, s := range snapshots {
+			for key, dialogCounts := range s.Counts {
+				if owners[key] != shard {
+					continue
+				}
+				for p, count := range dialogCounts {
+					counts[p] = count
+				}
+			}
+		}
+		for p := range current {
+			if _, ok := counts[p]; !ok {
+				counts[p] = 0
+			}
+		}
+		for _, s := range snapshots {
+			for _, e := range s.Events {
+				p := pair{UserId: e.UserId, CompanionId: e.CompanionId}
+				if _, ok := counts[p]; !ok {
+					counts[p] = 0
+				}
+			}
+		}
+
+		db := config.PrimaryDataBase()
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for p, count := range counts {
+			if _, ok := owners[dialog.Key(p.UserId, p.CompanionId)]; !ok {
+				continue
+			}
+			if unread, ok := current[p]; ok && unread == count {
+				continue
+			}
+			_, err = tx.Exec(`INSERT INTO counters(user_id, companion_id, unread) VALUES (?, ?, ?)
+									 ON DUPLICATE KEY UPDATE unread = VALUES(unread)`,
+				p.UserId,
+				p.CompanionId,
+				count,
+			)
+			if err != nil {
+				return err
+			}
+			fixed++
+		}
+		applied := make(map[string][]interface{})
+		for shard, s := range snapshots {
+			for _, e := range s.Events {
+				if owners[dialog.Key(e.UserId, e.CompanionId)] != shard {
+					continue
+				}
+				_, err = tx.Exec("INSERT IGNORE INTO counter_events(shard, event_key) VALUES (?, ?)", shard, e.Key)
+				if err != nil {
+					return err
+				}
+				applied[shard] = append(applied[shard], e.Key)
+			}
+		}
+		_, err = tx.Exec("DELETE FROM counter_events WHERE applied_at < ?", time.Now().Add(-eventsRetention))
+		if err != nil {
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		for shard, keys := range applied {
+			if err = deleteEvents(shard, keys); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return fixed, err
+}
+
+/* Read unread counts and pending events of shard from one snapshot */
+func snapshotShard(shard string) (*snapshot, error) {
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	s := &snapshot{Counts: make(map[string]map[pair]int), Events: make([]*event, 0)}
+	rows, err := tx.Query("SELECT event_key, user_id, companion_id, delta FROM outbox")
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		e := new(event)
+		if err = rows.Scan(&e.Key, &e.UserId, &e.CompanionId, &e.Delta); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Events = append(s.Events, e)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(`SELECT dialog_key, to_user_id, from_user_id, COUNT(*) FROM messages
+							  WHERE is_read = FALSE GROUP BY dialog_key, to_user_id, from_user_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var p pair
+		var count int
+		if err = rows.Scan(&key, &p.UserId, &p.CompanionId, &count); err != nil {
+			return nil, err
+		}
+		if s.Counts[key] == nil {
+			s.Counts[key] = make(map[pair]int)
+		}
+		s.Counts[key][p] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+func fetchAllCounters() (map[pair]int, error) {
+	db := config.PrimaryDataBase()
+	rows, err := db.Query("SELECT user_id, companion_id, unread FROM counters")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counters := make(map[pair]int)
+	for rows.Next() {
+		var p pair
+		var unread int
+		if err = rows.Scan(&p.UserId, &p.CompanionId, &unread); err != nil {
+			return nil, err
+		}
+		counters[p] = unread
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
@@ -0,0 +1,306 @@
+package dialog
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"social-network-study/config"
+	"strings"
+)
+
+/**
+ * Resharding of Dialogs without downtime.
+ * A dialog is copied to the target shard while writes keep
+ * going to the source, then it is locked for a short moment
+ * to copy the rest, switched over and removed from the source.
+ * Writers hold a shared lock of the route until they commit,
+ * so locking the dialog waits for the writes in flight.
+ * Hot dialogs can be moved to a dedicated shard this way
+ */
+
+type MoveOptions struct {
+	BatchSize int
+}
+
+const defaultBatchSize = 1000
+
+/* Move dialog to the target shard */
+func MoveDialog(key string, target string, options MoveOptions) error {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultBatchSize
+	}
+	key, err := ParseKey(key)
+	if err != nil {
+		return err
+	}
+	if !knownShard(target) {
+		return fmt.Errorf("unknown dialog shard %s, expected one of %s", target, strings.Join(config.ShardNames(), ", "))
+	}
+	r, err := lookupRoute(key)
+	if err != nil {
+		return err
+	}
+	if r.Shard == target {
+		return nil
+	}
+	if r.Status != routeActive && (!r.Target.Valid || r.Target.String != target) {
+		return fmt.Errorf("dialog %s is already being moved to %s", key, r.Target.String)
+	}
+	source := r.Shard
+
+	// Writes keep going to the source while it is copied
+	db := config.PrimaryDataBase()
+	_, err = db.Exec(`INSERT INTO dialog_routes(dialog_key, shard, target, status) VALUES (?, ?, ?, ?)
+							 ON DUPLICATE KEY UPDATE target = VALUES(target), status = VALUES(status)`,
+		key, source, target, routeMoving)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{"dialog": key, "source": source, "target": target}).Info("Copying dialog")
+	lastId, err := copyMessages(key, source, target, 0, options.BatchSize)
+	if err != nil {
+		return unlock(key, err)
+	}
+
+	// Update waits for shared locks of writes in flight, later ones see the lock
+	_, err = db.Exec("UPDATE dialog_routes SET status=? WHERE dialog_key=?", routeLocked, key)
+	if err != nil {
+		return unlock(key, err)
+	}
+	_, err = copyMessages(key, source, target, lastId, options.BatchSize)
+	if err != nil {
+		return unlock(key, err)
+	}
+	err = syncReadMarks(key, source, target)
+	if err != nil {
+		return unlock(key, err)
+	}
+
+	_, err = db.Exec("UPDATE dialog_routes SET shard=?, target=NULL, status=? WHERE dialog_key=?", target, routeActive, key)
+	if err != nil {
+		return unlock(key, err)
+	}
+	log.WithFields(log.Fields{"dialog": key, "target": target}).Info("Dialog switched")
+
+	return deleteMessages(key, source, options.BatchSize)
+}
+
+/**
+Move dialogs of ring shards to the shard owning them
+on the current ring, e.g. after a shard was added.
+Keys of dialogs are read page by page
+*/
+func Rebalance(options MoveOptions) error {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultBatchSize
+	}
+	for _, shard := range config.RingShardNames() {
+		afterKey := ""
+		for {
+			keys, err := fetchDialogKeys(shard, afterKey, options.BatchSize)
+			if err != nil {
+				return err
+			}
+			if err = rebalanceDialogs(shard, keys, options); err != nil {
+				return err
+			}
+			if len(keys) < options.BatchSize {
+				break
+			}
+			afterKey = keys[len(keys)-1]
+		}
+	}
+	return nil
+}
+
+func rebalanceDialogs(shard string, keys []string, options MoveOptions) error {
+	owners, err := Owners(keys)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if owners[key] != shard {
+			continue
+		}
+		owner := ringOwner(key)
+		if owner == shard {
+			continue
+		}
+		if err = MoveDialog(key, owner, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func knownShard(name string) bool {
+	for _, shard := range config.ShardNames() {
+		if shard == name {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+Return dialog to the source when move failed before
+the switch, copied messages are left to the next move
+*/
+func unlock(key string, cause error) error {
+	db := config.PrimaryDataBase()
+	_, err := db.Exec("UPDATE dialog_routes SET target=NULL, status=? WHERE dialog_key=?", routeActive, key)
+	if err != nil {
+		log.WithField("dialog", key).WithError(err).Error("Cannot unlock dialog")
+	}
+	return cause
+}
+
+/* Page of keys of dialogs stored in shard, ordered by key */
+func fetchDialogKeys(shard string, afterKey string, limit int) ([]string, error) {
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT DISTINCT dialog_key FROM messages
+								  WHERE dialog_key > ? ORDER BY dialog_key LIMIT ?`, afterKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0, limit)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+/* Copy messages with id greater than afterId, keeping ids */
+func copyMessages(key string, source string, target string, afterId int64, batchSize int) (int64, error) {
+	sourceDb, err := config.ShardDataBase(source)
+	if err != nil {
+		return afterId, err
+	}
+	targetDb, err := config.ShardDataBase(target)
+	if err != nil {
+		return afterId, err
+	}
+	for {
+		rows, err := sourceDb.Query(`SELECT id, from_user_id, to_user_id, text, is_read, created_at
+								  FROM messages WHERE dialog_key = ? AND id > ?
+								  ORDER BY id LIMIT ?`, key, afterId, batchSize)
+		if err != nil {
+			return afterId, err
+		}
+		args := make([]interface{}, 0, batchSize*7)
+		for rows.Next() {
+			message := new(Message)
+			err = rows.Scan(
+				&message.ID,
+				&message.FromUserId,
+				&message.ToUserId,
+				&message.Text,
+				&message.IsRead,
+				&message.CreatedAt,
+			)
+			if err != nil {
+				rows.Close()
+				return afterId, err
+			}
+			args = append(args, message.ID, key, message.FromUserId, message.ToUserId,
+				message.Text, message.IsRead, message.CreatedAt)
+			afterId = message.ID
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return afterId, err
+		}
+
+		count := len(args) / 7
+		if count == 0 {
+			return afterId, nil
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?),", count), ",")
+		_, err = targetDb.Exec(fmt.Sprintf(`INSERT INTO messages(id, dialog_key, from_user_id, to_user_id, text, is_read, created_at)
+								  VALUES %s ON DUPLICATE KEY UPDATE is_read = VALUES(is_read)`, placeholders), args...)
+		if err != nil {
+			return afterId, err
+		}
+		if count < batchSize {
+			return afterId, nil
+		}
+	}
+}
+
+/**
+Read marks only grow from the oldest message,
+so marking everything up to the last read message
+of each direction brings the copy up to date
+*/
+func syncReadMarks(key string, source string, target string) error {
+	sourceDb, err := config.ShardDataBase(source)
+	if err != nil {
+		return err
+	}
+	targetDb, err := config.ShardDataBase(target)
+	if err != nil {
+		return err
+	}
+	rows, err := sourceDb.Query(`SELECT from_user_id, MAX(id) FROM messages
+								  WHERE dialog_key = ? AND is_read = TRUE GROUP BY from_user_id`, key)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	marks := make(map[int]int64)
+	for rows.Next() {
+		var fromUserId int
+		var lastReadId sql.NullInt64
+		if err = rows.Scan(&fromUserId, &lastReadId); err != nil {
+			return err
+		}
+		marks[fromUserId] = lastReadId.Int64
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for fromUserId, lastReadId := range marks {
+		_, err = targetDb.Exec(`UPDATE messages SET is_read = TRUE
+								  WHERE dialog_key = ? AND from_user_id = ? AND id <= ? AND is_read = FALSE`,
+			key, fromUserId, lastReadId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteMessages(key string, shard string, batchSize int) error {
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return err
+	}
+	for {
+		exec, err := db.Exec("DELETE FROM messages WHERE dialog_key = ? LIMIT ?", key, batchSize)
+		if err != nil {
+			return err
+		}
+		deleted, err := exec.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted < int64(batchSize) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package dialog
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"social-network-study/model/user"
+	"strconv"
+)
+
+/* Get dialogs of user by id */
+func GetDialogs(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	id, _ := strconv.Atoi(queryParams.Get("id"))
+
+	err := user.CheckForbidden(id, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	dialogs, err := FetchDialogs(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(dialogs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Get messages of dialog with companion, page by page */
+func GetMessages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	companionId, _ := strconv.Atoi(vars["id"])
+	queryParams := r.URL.Query()
+	id, _ := strconv.Atoi(queryParams.Get("id"))
+	before, _ := strconv.ParseInt(queryParams.Get("before"), 10, 64)
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+
+	err := user.CheckForbidden(id, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	messages, err := FetchMessages(r.Context(), id, companionId, before, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(messages)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Mark messages of companion as read */
+func PutRead(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	companionId, _ := strconv.Atoi(vars["id"])
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+	err := user.CheckForbidden(id, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	read, err := MarkAsRead(r.Context(), id, companionId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !read {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, ErrDialogMoving.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/* Send message to companion */
+func PostMessage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	companionId, _ := strconv.Atoi(vars["id"])
+	message := new(Message)
+	err := json.NewDecoder(r.Body).Decode(message)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message.ToUserId = companionId
+
+	err = user.CheckForbidden(message.FromUserId, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	saved, err := SendMessage(r.Context(), message)
+	switch err {
+	case nil:
+	case ErrEmptyText, ErrSelfMessage:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case ErrRecipientNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case ErrDialogMoving:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
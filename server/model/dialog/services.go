@@ -0,0 +1,362 @@
+package dialog
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"social-network-study/config"
+	"social-network-study/metrics"
+	"social-network-study/model/user"
+	"sort"
+)
+
+/**
+ * Service for working with private Dialogs
+ */
+
+const (
+	defaultMessagesLimit = 50
+	maxMessagesLimit     = 100
+)
+
+var (
+	ErrEmptyText         = errors.New("message text must be present")
+	ErrSelfMessage       = errors.New("cannot send message to yourself")
+	ErrRecipientNotFound = errors.New("recipient not found")
+)
+
+type Message struct {
+	ID         int64  `json:"id"`
+	FromUserId int    `json:"fromUserId"`
+	ToUserId   int    `json:"toUserId"`
+	Text       string `json:"text"`
+	IsRead     bool   `json:"isRead"`
+	CreatedAt  string `json:"createdAt"`
+	dialogKey  string
+}
+
+type Dialog struct {
+	Companion   *user.Friend `json:"companion"`
+	LastMessage *Message     `json:"lastMessage"`
+	UnreadCount int          `json:"unreadCount"`
+}
+
+/* Send message from one User to another */
+func SendMessage(ctx context.Context, message *Message) (*Message, error) {
+	defer metrics.Measure("dialog.SendMessage")()
+	if message.Text == "" {
+		return nil, ErrEmptyText
+	}
+	if message.FromUserId == message.ToUserId {
+		return nil, ErrSelfMessage
+	}
+	recipient, err := user.FetchUserById(ctx, message.ToUserId)
+	if err != nil {
+		return nil, err
+	}
+	if recipient.ID == 0 {
+		return nil, ErrRecipientNotFound
+	}
+
+	key := Key(message.FromUserId, message.ToUserId)
+	// Lock of route is released when the message is committed
+	routes, err := config.PrimaryDataBase().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer routes.Rollback()
+	r, err := writeRoute(routes, key)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := shardTx(routes, r.Shard)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exec, err := tx.Exec("INSERT INTO messages(dialog_key, from_user_id, to_user_id, text) VALUES (?, ?, ?, ?)",
+		key,
+		message.FromUserId,
+		message.ToUserId,
+		message.Text,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := exec.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	err = saveCounterEvent(tx, message.ToUserId, message.FromUserId, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := new(Message)
+	err = tx.QueryRow(`SELECT id, dialog_key, from_user_id, to_user_id, text, is_read, created_at
+							  FROM messages WHERE dialog_key=? AND id=?`, key, id).Scan(
+		&saved.ID,
+		&saved.dialogKey,
+		&saved.FromUserId,
+		&saved.ToUserId,
+		&saved.Text,
+		&saved.IsRead,
+		&saved.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+/**
+Get dialogs of User with last message and unread count.
+Dialogs are gathered from every shard, copies left
+by a move in progress are skipped
+*/
+func FetchDialogs(ctx context.Context, id int) ([]*Dialog, error) {
+	defer metrics.Measure("dialog.FetchDialogs")()
+	dialogs := make([]*Dialog, 0)
+	for _, shard := range config.ShardNames() {
+		shardDialogs, err := fetchShardDialogs(shard, id)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(shardDialogs))
+		for _, dialog := range shardDialogs {
+			keys = append(keys, dialog.LastMessage.dialogKey)
+		}
+		routes, err := lookupRoutes(keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, dialog := range shardDialogs {
+			if routes[dialog.LastMessage.dialogKey].Shard == shard {
+				dialogs = append(dialogs, dialog)
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(dialogs))
+	for _, dialog := range dialogs {
+		ids = append(ids, dialog.Companion.ID)
+	}
+	companions, err := user.FetchFriendsByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	companionsById := make(map[int]*user.Friend, len(companions))
+	for _, companion := range companions {
+		companionsById[companion.ID] = companion
+	}
+
+	result := make([]*Dialog, 0, len(dialogs))
+	for _, dialog := range dialogs {
+		companion, ok := companionsById[dialog.Companion.ID]
+		if !ok {
+			continue
+		}
+		dialog.Companion = companion
+		result = append(result, dialog)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].LastMessage, result[j].LastMessage
+		if a.CreatedAt != b.CreatedAt {
+			return a.CreatedAt > b.CreatedAt
+		}
+		return a.ID > b.ID
+	})
+	return result, nil
+}
+
+func fetchShardDialogs(shard string, id int) ([]*Dialog, error) {
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT m.id, m.dialog_key, m.from_user_id, m.to_user_id, m.text, m.is_read, m.created_at,
+								  (SELECT COUNT(*) FROM messages r
+								   WHERE r.dialog_key = m.dialog_key AND r.to_user_id = ? AND r.is_read = FALSE)
+								  FROM messages m
+								  INNER JOIN (SELECT dialog_key, MAX(id) last_id
+								              FROM messages WHERE from_user_id = ? OR to_user_id = ?
+								              GROUP BY dialog_key) d ON m.dialog_key = d.dialog_key AND m.id = d.last_id`,
+		id, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dialogs := make([]*Dialog, 0)
+	for rows.Next() {
+		dialog := &Dialog{Companion: new(user.Friend), LastMessage: new(Message)}
+		err = rows.Scan(
+			&dialog.LastMessage.ID,
+			&dialog.LastMessage.dialogKey,
+			&dialog.LastMessage.FromUserId,
+			&dialog.LastMessage.ToUserId,
+			&dialog.LastMessage.Text,
+			&dialog.LastMessage.IsRead,
+			&dialog.LastMessage.CreatedAt,
+			&dialog.UnreadCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		dialog.Companion.ID = dialog.LastMessage.FromUserId
+		if dialog.Companion.ID == id {
+			dialog.Companion.ID = dialog.LastMessage.ToUserId
+		}
+		dialogs = append(dialogs, dialog)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return dialogs, nil
+}
+
+/* Get page of messages between User and companion, newest first */
+func FetchMessages(ctx context.Context, id int, companionId int, before int64, limit int) ([]*Message, error) {
+	defer metrics.Measure("dialog.FetchMessages")()
+	if limit <= 0 {
+		limit = defaultMessagesLimit
+	}
+	if limit > maxMessagesLimit {
+		limit = maxMessagesLimit
+	}
+
+	key := Key(id, companionId)
+	r, err := lookupRoute(key)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := config.ShardDataBase(r.Shard)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT id, dialog_key, from_user_id, to_user_id, text, is_read, created_at
+								  FROM messages
+								  WHERE dialog_key = ? AND (? = 0 OR id < ?)
+								  ORDER BY id DESC LIMIT ?`, key, before, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*Message, 0)
+	for rows.Next() {
+		message := new(Message)
+		err = rows.Scan(
+			&message.ID,
+			&message.dialogKey,
+			&message.FromUserId,
+			&message.ToUserId,
+			&message.Text,
+			&message.IsRead,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+/**
+Mark all messages from companion to User as read.
+While dialog is being moved both copies are marked,
+counter is changed only by the copy in use. Locked
+dialog is left unread, false is returned then
+*/
+func MarkAsRead(ctx context.Context, id int, companionId int) (bool, error) {
+	defer metrics.Measure("dialog.MarkAsRead")()
+	key := Key(id, companionId)
+	// Lock of route is released when both copies are marked
+	routes, err := config.PrimaryDataBase().BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer routes.Rollback()
+	r, err := lockRoute(routes, key)
+	if err != nil {
+		return false, err
+	}
+	if r.Status == routeLocked {
+		return false, nil
+	}
+
+	tx, err := shardTx(routes, r.Shard)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	exec, err := tx.ExecContext(ctx, `UPDATE messages SET is_read = TRUE
+							 WHERE dialog_key = ? AND from_user_id = ? AND to_user_id = ? AND is_read = FALSE`,
+		key,
+		companionId,
+		id,
+	)
+	if err != nil {
+		return false, err
+	}
+	read, err := exec.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if read > 0 {
+		err = saveCounterEvent(tx, id, companionId, -read)
+		if err != nil {
+			return false, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+
+	if r.Status != routeActive && r.Target.Valid {
+		target, err := config.ShardDataBase(r.Target.String)
+		if err != nil {
+			return false, err
+		}
+		_, err = target.ExecContext(ctx, `UPDATE messages SET is_read = TRUE
+								  WHERE dialog_key = ? AND from_user_id = ? AND to_user_id = ? AND is_read = FALSE`,
+			key,
+			companionId,
+			id,
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+/**
+Save change of unread counter into outbox
+in the same transaction as the messages,
+counters are updated from it asynchronously.
+Events are told apart by their key, ids of
+outbox are reused after restarts of MySQL 5.7
+*/
+func saveCounterEvent(tx *sql.Tx, userId int, companionId int, delta int64) error {
+	_, err := tx.Exec("INSERT INTO outbox(event_key, user_id, companion_id, delta) VALUES (UUID(), ?, ?, ?)",
+		userId,
+		companionId,
+		delta,
+	)
+	return err
+}
@@ -0,0 +1,291 @@
+package dialog
+
+import (
+	"crypto/md5"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"social-network-study/config"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+ * Routing of Dialogs between shards.
+ * New dialogs are placed by consistent hashing of the
+ * ordered user pair, the placement is then recorded in
+ * dialog_routes so that dialogs can be moved later on.
+ * Routes are kept on the primary, a lagging replica
+ * would point to the shard a dialog was moved from
+ */
+
+const (
+	routeActive = "active"
+	routeMoving = "moving"
+	routeLocked = "locked"
+
+	routesBatchSize = 1000
+
+	// Writers hold it until they commit, moves wait for them
+	shareLock = " LOCK IN SHARE MODE"
+)
+
+var ErrDialogMoving = errors.New("dialog is being moved to another shard, try again later")
+
+type route struct {
+	DialogKey string
+	Shard     string
+	Target    sql.NullString
+	Status    string
+	saved     bool
+}
+
+/* Single rows of database or of transaction */
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+type hashRing struct {
+	hashes []uint32
+	owners map[uint32]string
+}
+
+var ring *hashRing
+var ringOnce sync.Once
+
+/* Build conversation key from the ordered user pair */
+func Key(userId int, companionId int) string {
+	if userId > companionId {
+		userId, companionId = companionId, userId
+	}
+	return fmt.Sprintf("%d:%d", userId, companionId)
+}
+
+/* Check key of dialog given by hand and order its users, e.g. 2:1 becomes 1:2 */
+func ParseKey(key string) (string, error) {
+	parts := strings.Split(key, ":")
+	if len(parts) == 2 {
+		userId, userErr := strconv.Atoi(parts[0])
+		companionId, companionErr := strconv.Atoi(parts[1])
+		if userErr == nil && companionErr == nil && userId > 0 && companionId > 0 && userId != companionId {
+			return Key(userId, companionId), nil
+		}
+	}
+	return "", fmt.Errorf("dialog key must be two different user ids like 1:2, got %q", key)
+}
+
+func newHashRing(names []string, virtualNodes int) *hashRing {
+	r := &hashRing{owners: make(map[uint32]string)}
+	for _, name := range names {
+		for i := 0; i < virtualNodes; i++ {
+			hash := ringHash(fmt.Sprintf("%s#%d", name, i))
+			r.hashes = append(r.hashes, hash)
+			r.owners[hash] = name
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+func (r *hashRing) owner(key string) string {
+	hash := ringHash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
+
+/**
+Position on the ring. Checksums like CRC32 place similar
+names of virtual nodes close to each other, which leaves
+shards with uneven shares, digest spreads them evenly
+*/
+func ringHash(text string) uint32 {
+	digest := md5.Sum([]byte(text))
+	return binary.BigEndian.Uint32(digest[:4])
+}
+
+/* Shard owning the key on the hash ring */
+func ringOwner(key string) string {
+	ringOnce.Do(func() {
+		ring = newHashRing(config.RingShardNames(), config.ShardVirtualNodes())
+	})
+	return ring.owner(key)
+}
+
+/* Find where dialog lives, falling back to the hash ring */
+func lookupRoute(key string) (*route, error) {
+	return queryRoute(config.PrimaryDataBase(), key, "")
+}
+
+/**
+Find route of dialog in transaction of the primary and keep
+it locked in share mode until the transaction ends, so that
+a move cannot lock the dialog while a write is in flight
+*/
+func lockRoute(tx *sql.Tx, key string) (*route, error) {
+	return queryRoute(tx, key, shareLock)
+}
+
+func queryRoute(q querier, key string, lock string) (*route, error) {
+	r := &route{DialogKey: key}
+	err := q.QueryRow("SELECT shard, target, status FROM dialog_routes WHERE dialog_key=?"+lock, key).Scan(
+		&r.Shard,
+		&r.Target,
+		&r.Status,
+	)
+	if err == sql.ErrNoRows {
+		r.Shard = ringOwner(key)
+		r.Status = routeActive
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.saved = true
+	return r, nil
+}
+
+/* Find routes of several dialogs at once */
+func lookupRoutes(keys []string) (map[string]*route, error) {
+	routes := make(map[string]*route)
+	if len(keys) == 0 {
+		return routes, nil
+	}
+	db := config.PrimaryDataBase()
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")
+	rows, err := db.Query(fmt.Sprintf(`SELECT dialog_key, shard, target, status
+								  FROM dialog_routes WHERE dialog_key IN (%s)`, placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		r := &route{saved: true}
+		err = rows.Scan(&r.DialogKey, &r.Shard, &r.Target, &r.Status)
+		if err != nil {
+			return nil, err
+		}
+		routes[r.DialogKey] = r
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if _, ok := routes[key]; !ok {
+			routes[key] = &route{DialogKey: key, Shard: ringOwner(key), Status: routeActive}
+		}
+	}
+	return routes, nil
+}
+
+/**
+Shards of dialogs which are not being moved,
+dialogs being moved are left out
+*/
+func Owners(keys []string) (map[string]string, error) {
+	unique := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+
+	owners := make(map[string]string, len(unique))
+	for start := 0; start < len(unique); start += routesBatchSize {
+		end := start + routesBatchSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+		routes, err := lookupRoutes(unique[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for key, r := range routes {
+			if r.Status == routeActive {
+				owners[key] = r.Shard
+			}
+		}
+	}
+	return owners, nil
+}
+
+/**
+Find route of dialog for writing a new message and lock
+it like lockRoute. The placement of a new dialog is saved
+first, so that later changes of the ring do not lose it
+*/
+func writeRoute(tx *sql.Tx, key string) (*route, error) {
+	r, err := lookupRoute(key)
+	if err != nil {
+		return nil, err
+	}
+	if !r.saved {
+		db := config.PrimaryDataBase()
+		_, err = db.Exec("INSERT IGNORE INTO dialog_routes(dialog_key, shard) VALUES (?, ?)", key, r.Shard)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r, err = lockRoute(tx, key)
+	if err != nil {
+		return nil, err
+	}
+	if r.Status == routeLocked {
+		return nil, ErrDialogMoving
+	}
+	return r, nil
+}
+
+/**
+Transaction of shard writing dialog while routes holds its
+route. Without shards dialogs are stored in the primary,
+the transaction of routes is used then, which keeps a
+single connection of the pool per write
+*/
+func shardTx(routes *sql.Tx, shard string) (*sql.Tx, error) {
+	if !config.ShardsConfigured() {
+		return routes, nil
+	}
+	db, err := config.ShardDataBase(shard)
+	if err != nil {
+		return nil, err
+	}
+	return db.Begin()
+}
+
+/**
+Place many new dialogs at once for bulk loading.
+Placements are recorded like in writeRoute, shards
+of dialogs which are not being moved are returned
+*/
+func PlaceDialogs(keys []string) (map[string]string, error) {
+	db := config.PrimaryDataBase()
+	for start := 0; start < len(keys); start += routesBatchSize {
+		end := start + routesBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		args := make([]interface{}, 0, 2*(end-start))
+		for _, key := range keys[start:end] {
+			args = append(args, key, ringOwner(key))
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("(?, ?),", end-start), ",")
+		_, err := db.Exec(fmt.Sprintf("INSERT IGNORE INTO dialog_routes(dialog_key, shard) VALUES %s", placeholders), args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Owners(keys)
+}
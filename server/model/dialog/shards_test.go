@@ -0,0 +1,93 @@
+package dialog
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	for key, want := range map[string]string{"1:2": "1:2", "2:1": "1:2", "12:3": "3:12"} {
+		if got, err := ParseKey(key); err != nil || got != want {
+			t.Errorf("ParseKey(%q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	// Keys typed by hand must not create routes nobody can reach
+	for _, key := range []string{"", "1", "1:1", "0:2", "-1:2", "1:2:3", "1-2", "a:b", " 1:2"} {
+		if got, err := ParseKey(key); err == nil {
+			t.Errorf("ParseKey(%q) = %q, want error", key, got)
+		}
+	}
+}
+
+func TestRingSpreadsKeysEvenly(t *testing.T) {
+	const keys = 20000
+	for shardCount := 2; shardCount <= 8; shardCount *= 2 {
+		names := make([]string, shardCount)
+		for i := range names {
+			names[i] = fmt.Sprintf("shard-%d", i+1)
+		}
+		ring := newHashRing(names, 100)
+		counts := make(map[string]int)
+		for i := 1; i <= keys; i++ {
+			counts[ring.owner(Key(i, i+1+i%97))]++
+		}
+		even := float64(keys) / float64(shardCount)
+		for _, name := range names {
+			if share := float64(counts[name]) / even; math.Abs(share-1) > 0.25 {
+				t.Errorf("%d shards: %s owns %.2f of its even share", shardCount, name, share)
+			}
+		}
+	}
+}
+
+func TestRingIgnoresOrderOfShards(t *testing.T) {
+	ring := newHashRing([]string{"shard-1", "shard-2", "shard-3"}, 100)
+	reordered := newHashRing([]string{"shard-3", "shard-1", "shard-2"}, 100)
+	for i := 1; i < 1000; i++ {
+		key := Key(i, i+1)
+		if ring.owner(key) != reordered.owner(key) {
+			t.Fatalf("owner of %s depends on order of shards", key)
+		}
+	}
+}
+
+func TestAddedShardOnlyTakesKeys(t *testing.T) {
+	before := newHashRing([]string{"shard-1", "shard-2", "shard-3"}, 100)
+	after := newHashRing([]string{"shard-1", "shard-2", "shard-3", "shard-4"}, 100)
+	const keys = 20000
+	moved := 0
+	for i := 1; i <= keys; i++ {
+		key := Key(i, i+keys)
+		owner := after.owner(key)
+		if owner == before.owner(key) {
+			continue
+		}
+		if owner != "shard-4" {
+			t.Fatalf("key %s moved from %s to %s, rebalance would copy it twice", key, before.owner(key), owner)
+		}
+		moved++
+	}
+	if share := float64(moved) / keys; share < 0.2 || share > 0.3 {
+		t.Errorf("%.2f of keys moved to the new shard, want about a quarter", share)
+	}
+}
+
+func TestRingWrapsAround(t *testing.T) {
+	key := Key(1, 2)
+	hash := ringHash(key)
+	if hash == 0 || hash == math.MaxUint32 {
+		t.Skip("hash of key is at the edge of the ring")
+	}
+	ring := &hashRing{
+		hashes: []uint32{hash - 1, hash, hash + 1},
+		owners: map[uint32]string{hash - 1: "below", hash: "at", hash + 1: "above"},
+	}
+	if owner := ring.owner(key); owner != "at" {
+		t.Errorf("virtual node at hash of key is skipped, owner is %s", owner)
+	}
+	ring = &hashRing{hashes: []uint32{hash - 1}, owners: map[uint32]string{hash - 1: "first"}}
+	if owner := ring.owner(key); owner != "first" {
+		t.Errorf("key past the last virtual node is owned by %s, want the first node", owner)
+	}
+}
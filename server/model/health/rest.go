@@ -0,0 +1,33 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+/* Process is alive and serves requests */
+func GetLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	err := json.NewEncoder(w).Encode(&Report{Status: statusOk, Checks: map[string]*Check{}})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Every dependency is ready, otherwise 503 with the failed checks */
+func GetReadiness(w http.ResponseWriter, r *http.Request) {
+	report := Readiness(r.Context())
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Cache-Control", "no-store")
+	if report.Status != statusOk {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(report)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,160 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"social-network-study/config"
+	"social-network-study/model/counter"
+	"strconv"
+	"time"
+)
+
+/**
+ * Service for checking Health of the application dependencies
+ */
+
+const (
+	statusOk   = "ok"
+	statusFail = "fail"
+
+	checkTimeout = 2 * time.Second
+)
+
+type Check struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Info   map[string]interface{} `json:"info,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]*Check `json:"checks"`
+}
+
+var lagBudget = 10 * time.Second
+
+func Init(cfg *config.Config) {
+	if cfg.Database.ReplicaLagBudget > 0 {
+		lagBudget = cfg.Database.ReplicaLagBudget
+	}
+}
+
+/* Check every dependency needed to serve requests */
+func Readiness(ctx context.Context) *Report {
+	report := &Report{Status: statusOk, Checks: make(map[string]*Check)}
+
+	for host, db := range config.DataBasesByHost() {
+		report.add("database "+host, checkDataBase(ctx, db, config.MigrationDirOf(config.MainTarget)))
+	}
+	if config.ShardsConfigured() {
+		for _, name := range config.ShardNames() {
+			db, err := config.ShardDataBase(name)
+			if err != nil {
+				check := &Check{Status: statusOk}
+				check.fail(err)
+				report.add("shard "+name, check)
+				continue
+			}
+			report.add("shard "+name, checkDataBase(ctx, db, config.MigrationDirOf(name)))
+		}
+	}
+
+	lastRelay, err := counter.Status()
+	check := &Check{Status: statusOk, Info: map[string]interface{}{"lastRelay": lastRelay.Format(time.RFC3339)}}
+	if err != nil {
+		check.fail(err)
+	}
+	report.add("counters relay", check)
+	return report
+}
+
+func (r *Report) add(name string, check *Check) {
+	r.Checks[name] = check
+	if check.Status != statusOk {
+		r.Status = statusFail
+	}
+}
+
+func (c *Check) fail(err error) *Check {
+	c.Status = statusFail
+	c.Error = err.Error()
+	return c
+}
+
+/**
+Database must answer ping, replicas must not lag
+more than budget, primaries must have all migrations
+*/
+func checkDataBase(ctx context.Context, db *sql.DB, migrationDir string) *Check {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	check := &Check{Status: statusOk, Info: make(map[string]interface{})}
+
+	if err := db.PingContext(ctx); err != nil {
+		return check.fail(err)
+	}
+
+	lag, replica, err := replicaLag(ctx, db)
+	if err != nil {
+		return check.fail(err)
+	}
+	if replica {
+		check.Info["role"] = "replica"
+		if !lag.Valid {
+			return check.fail(fmt.Errorf("replication is not running"))
+		}
+		check.Info["lagSeconds"] = lag.Int64
+		if time.Duration(lag.Int64)*time.Second > lagBudget {
+			return check.fail(fmt.Errorf("replica lags %ds behind, budget is %s", lag.Int64, lagBudget))
+		}
+		return check
+	}
+
+	check.Info["role"] = "primary"
+	status, err := config.SchemaStatusOf(ctx, db, migrationDir)
+	if err != nil {
+		return check.fail(err)
+	}
+	check.Info["migration"] = status.Version
+	if err = status.Err(); err != nil {
+		return check.fail(err)
+	}
+	return check
+}
+
+/* Seconds behind master, replica is false for primaries */
+func replicaLag(ctx context.Context, db *sql.DB) (sql.NullInt64, bool, error) {
+	var lag sql.NullInt64
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return lag, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return lag, false, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return lag, true, err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return lag, true, err
+	}
+	for i, column := range columns {
+		if column == "Seconds_Behind_Master" && values[i] != nil {
+			seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+			if err != nil {
+				return lag, true, err
+			}
+			lag = sql.NullInt64{Int64: seconds, Valid: true}
+		}
+	}
+	return lag, true, rows.Err()
+}
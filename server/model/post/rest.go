@@ -0,0 +1,190 @@
+package post
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"social-network-study/model/user"
+	"strconv"
+)
+
+/* Create new post */
+func PostPost(w http.ResponseWriter, r *http.Request) {
+	newPost := new(Post)
+	err := json.NewDecoder(r.Body).Decode(newPost)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = user.CheckForbidden(newPost.UserId, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	saved, err := Create(newPost)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Get posts of user by id, page by page */
+func GetPosts(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	userId := user.UserIdParam(r, "userId")
+	before, _ := strconv.Atoi(queryParams.Get("before"))
+	limit, _ := strconv.Atoi(queryParams.Get("limit"))
+
+	currentUser, err := user.GetCurrentPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	posts, err := FetchPosts(userId, currentUser.ID, before, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(posts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Get post by id */
+func GetPost(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	currentUser, err := user.GetCurrentPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	post, err := FetchPostById(id, currentUser.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(post)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Like post by current user */
+func PutLike(w http.ResponseWriter, r *http.Request) {
+	changeLikeHandler(w, r, AddLike)
+}
+
+/* Remove like of current user from post */
+func DeleteLike(w http.ResponseWriter, r *http.Request) {
+	changeLikeHandler(w, r, RemoveLike)
+}
+
+func changeLikeHandler(w http.ResponseWriter, r *http.Request, change func(int, int) (*Like, error)) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	currentUser, err := user.GetCurrentPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	like, err := change(id, currentUser.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(like)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Get comments of post as a tree */
+func GetComments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	comments, err := FetchComments(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(comments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Add comment or reply to post */
+func PostComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	comment := new(Comment)
+	err := json.NewDecoder(r.Body).Decode(comment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	comment.PostId = id
+
+	err = user.CheckForbidden(comment.UserId, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	saved, err := AddComment(comment)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(saved)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrEmptyText, ErrParentNotFound:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case ErrPostNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case ErrCommentsForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,427 @@
+package post
+
+import (
+	"database/sql"
+	"errors"
+	"social-network-study/config"
+	"social-network-study/metrics"
+	"strings"
+)
+
+/**
+ * Service for working with Posts, Likes and Comments.
+ * Writes are read back on the primary, replicas may lag
+ */
+
+const (
+	defaultPostsLimit = 20
+	maxPostsLimit     = 100
+)
+
+var (
+	ErrEmptyText         = errors.New("text must be present")
+	ErrPostNotFound      = errors.New("post not found")
+	ErrParentNotFound    = errors.New("parent comment not found")
+	ErrCommentsForbidden = errors.New("only friends of author can comment this post")
+)
+
+type Post struct {
+	ID                  int    `json:"id"`
+	UserId              int    `json:"userId"`
+	Text                string `json:"text"`
+	FriendsOnlyComments bool   `json:"friendsOnlyComments"`
+	LikesCount          int    `json:"likesCount"`
+	CommentsCount       int    `json:"commentsCount"`
+	Liked               bool   `json:"liked"`
+	CreatedAt           string `json:"createdAt"`
+}
+
+type Like struct {
+	PostId     int  `json:"postId"`
+	LikesCount int  `json:"likesCount"`
+	Liked      bool `json:"liked"`
+}
+
+type Comment struct {
+	ID        int        `json:"id"`
+	PostId    int        `json:"postId"`
+	UserId    int        `json:"userId"`
+	ParentId  *int       `json:"parentId"`
+	Text      string     `json:"text"`
+	CreatedAt string     `json:"createdAt"`
+	Replies   []*Comment `json:"replies"`
+}
+
+/* Create new Post */
+func Create(post *Post) (*Post, error) {
+	defer metrics.Measure("post.Create")()
+	if post.Text == "" {
+		return nil, ErrEmptyText
+	}
+	db := config.PrimaryDataBase()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exec, err := tx.Exec("INSERT INTO posts(user_id, text, friends_only_comments) VALUES (?, ?, ?)",
+		post.UserId,
+		post.Text,
+		post.FriendsOnlyComments,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := exec.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := queryPost(tx, int(id), post.UserId)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+/* Get Post by id, liked is computed for viewer */
+func FetchPostById(id int, viewerId int) (*Post, error) {
+	defer metrics.Measure("post.FetchPostById")()
+	return queryPost(config.DataBase(), id, viewerId)
+}
+
+/* Single rows of database or of transaction */
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func queryPost(q querier, id int, viewerId int) (*Post, error) {
+	post := new(Post)
+	err := q.QueryRow(`SELECT p.id, p.user_id, p.text, p.friends_only_comments, p.likes_count, p.comments_count,
+							   EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?), p.created_at
+							   FROM posts p WHERE p.id=?`, viewerId, id).Scan(
+		&post.ID,
+		&post.UserId,
+		&post.Text,
+		&post.FriendsOnlyComments,
+		&post.LikesCount,
+		&post.CommentsCount,
+		&post.Liked,
+		&post.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+/**
+Get page of posts of User, newest first.
+Counts are kept in posts, so listing
+takes a single query
+*/
+func FetchPosts(userId int, viewerId int, before int, limit int) ([]*Post, error) {
+	defer metrics.Measure("post.FetchPosts")()
+	limit = postsLimit(limit)
+
+	db := config.DataBase()
+	rows, err := db.Query(`SELECT p.id, p.user_id, p.text, p.friends_only_comments, p.likes_count, p.comments_count,
+								  EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?), p.created_at
+								  FROM posts p
+								  WHERE p.user_id = ? AND (? = 0 OR p.id < ?)
+								  ORDER BY p.id DESC LIMIT ?`, viewerId, userId, before, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := make([]*Post, 0)
+	for rows.Next() {
+		post := new(Post)
+		err = rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Text,
+			&post.FriendsOnlyComments,
+			&post.LikesCount,
+			&post.CommentsCount,
+			&post.Liked,
+			&post.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+/**
+Get pages of posts of several Users in one query, each
+of them newest first. MySQL 5.7 has no window functions,
+so pages of users are queried by index and united
+*/
+func FetchPostsOfUsers(userIds []int, viewerId int, before int, limit int) (map[int][]*Post, error) {
+	defer metrics.Measure("post.FetchPostsOfUsers")()
+	posts := make(map[int][]*Post, len(userIds))
+	if len(userIds) == 0 {
+		return posts, nil
+	}
+	limit = postsLimit(limit)
+
+	pages := make([]string, 0, len(userIds))
+	args := make([]interface{}, 0, len(userIds)*5)
+	for _, userId := range userIds {
+		pages = append(pages, `(SELECT p.id, p.user_id, p.text, p.friends_only_comments, p.likes_count, p.comments_count,
+								  EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?) AS liked, p.created_at
+								  FROM posts p
+								  WHERE p.user_id = ? AND (? = 0 OR p.id < ?)
+								  ORDER BY p.id DESC LIMIT ?)`)
+		args = append(args, viewerId, userId, before, before, limit)
+	}
+	db := config.DataBase()
+	rows, err := db.Query(strings.Join(pages, " UNION ALL ")+" ORDER BY user_id, id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		post := new(Post)
+		err = rows.Scan(
+			&post.ID,
+			&post.UserId,
+			&post.Text,
+			&post.FriendsOnlyComments,
+			&post.LikesCount,
+			&post.CommentsCount,
+			&post.Liked,
+			&post.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts[post.UserId] = append(posts[post.UserId], post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+/* Size of page of posts, the default one when it is 0 */
+func postsLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPostsLimit
+	}
+	if limit > maxPostsLimit {
+		return maxPostsLimit
+	}
+	return limit
+}
+
+/* Like Post, liking twice changes nothing */
+func AddLike(postId int, userId int) (*Like, error) {
+	defer metrics.Measure("post.AddLike")()
+	return changeLike(postId, userId,
+		"INSERT IGNORE INTO likes(post_id, user_id) VALUES (?, ?)",
+		"UPDATE posts SET likes_count = likes_count + 1 WHERE id=?")
+}
+
+/* Remove like from Post, removing twice changes nothing */
+func RemoveLike(postId int, userId int) (*Like, error) {
+	defer metrics.Measure("post.RemoveLike")()
+	return changeLike(postId, userId,
+		"DELETE FROM likes WHERE post_id=? AND user_id=?",
+		"UPDATE posts SET likes_count = likes_count - 1 WHERE id=?")
+}
+
+/* Count is changed only when like itself was changed */
+func changeLike(postId int, userId int, likeQuery string, countQuery string) (*Like, error) {
+	db := config.PrimaryDataBase()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	like := &Like{PostId: postId}
+	err = tx.QueryRow("SELECT likes_count FROM posts WHERE id=? FOR UPDATE", postId).Scan(&like.LikesCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exec, err := tx.Exec(likeQuery, postId, userId)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := exec.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if changed > 0 {
+		_, err = tx.Exec(countQuery, postId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.QueryRow(`SELECT p.likes_count, EXISTS(SELECT 1 FROM likes l WHERE l.post_id = p.id AND l.user_id = ?)
+							  FROM posts p WHERE p.id=?`, userId, postId).Scan(&like.LikesCount, &like.Liked)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return like, nil
+}
+
+/* Get comments of Post as a tree */
+func FetchComments(postId int) ([]*Comment, error) {
+	defer metrics.Measure("post.FetchComments")()
+	db := config.DataBase()
+	rows, err := db.Query(`SELECT id, post_id, user_id, parent_id, text, created_at
+								  FROM comments WHERE post_id=? ORDER BY id`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roots := make([]*Comment, 0)
+	byId := make(map[int]*Comment)
+	for rows.Next() {
+		comment := &Comment{Replies: make([]*Comment, 0)}
+		err = rows.Scan(
+			&comment.ID,
+			&comment.PostId,
+			&comment.UserId,
+			&comment.ParentId,
+			&comment.Text,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		byId[comment.ID] = comment
+		// Parents always have smaller ids than their replies
+		if parent, ok := byId[derefInt(comment.ParentId)]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+/**
+Add comment to Post. When author restricted comments
+only author and friends of author can comment
+*/
+func AddComment(comment *Comment) (*Comment, error) {
+	defer metrics.Measure("post.AddComment")()
+	if comment.Text == "" {
+		return nil, ErrEmptyText
+	}
+	db := config.PrimaryDataBase()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var authorId int
+	var friendsOnly bool
+	err = tx.QueryRow("SELECT user_id, friends_only_comments FROM posts WHERE id=? FOR UPDATE", comment.PostId).Scan(
+		&authorId,
+		&friendsOnly,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if friendsOnly && authorId != comment.UserId {
+		var friends bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM friends WHERE user_id=? AND friend_id=?)",
+			authorId, comment.UserId).Scan(&friends)
+		if err != nil {
+			return nil, err
+		}
+		if !friends {
+			return nil, ErrCommentsForbidden
+		}
+	}
+	if comment.ParentId != nil {
+		var exists bool
+		err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM comments WHERE id=? AND post_id=?)",
+			*comment.ParentId, comment.PostId).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrParentNotFound
+		}
+	}
+
+	exec, err := tx.Exec("INSERT INTO comments(post_id, user_id, parent_id, text) VALUES (?, ?, ?, ?)",
+		comment.PostId,
+		comment.UserId,
+		comment.ParentId,
+		comment.Text,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("UPDATE posts SET comments_count = comments_count + 1 WHERE id=?", comment.PostId)
+	if err != nil {
+		return nil, err
+	}
+	id, err := exec.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	saved := &Comment{Replies: make([]*Comment, 0)}
+	err = tx.QueryRow("SELECT id, post_id, user_id, parent_id, text, created_at FROM comments WHERE id=?", id).Scan(
+		&saved.ID,
+		&saved.PostId,
+		&saved.UserId,
+		&saved.ParentId,
+		&saved.Text,
+		&saved.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func derefInt(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
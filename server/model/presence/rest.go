@@ -0,0 +1,162 @@
+package presence
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"social-network-study/model/auth"
+	"social-network-study/model/user"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var upgrader = websocket.Upgrader{
+	// Token is passed explicitly, origin is checked for session cookie
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+var socketsMutex sync.Mutex
+var sockets = make(map[*websocket.Conn]bool)
+
+/* Update last seen time of authenticated users */
+func Track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		tokenString := request.Header.Get("Authorization")
+		if strings.HasPrefix(tokenString, "Bearer ") {
+			login, err := auth.GetLoginByToken(tokenString[7:]) //7 corresponds to "Bearer "
+			if err == nil {
+				go Touch(login)
+			}
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+/* Get presence of users by ids */
+func GetPresence(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	ids := make([]int, 0, len(queryParams["ids"]))
+	for _, value := range queryParams["ids"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	presence, err := FetchPresence(ids)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(presence)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/* Update privacy settings of presence */
+func PutSettings(w http.ResponseWriter, r *http.Request) {
+	settings := new(Settings)
+	err := json.NewDecoder(r.Body).Decode(settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = user.CheckForbidden(settings.UserId, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	_, err = UpdateSettings(settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+/**
+WebSocket for heartbeats of client.
+Browsers cannot set headers on WebSocket,
+so token may be passed as query parameter
+or in session cookie
+*/
+func GetSocket(w http.ResponseWriter, r *http.Request) {
+	tokenString := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		tokenString = header[7:] //7 corresponds to "Bearer "
+	}
+	if session := auth.CookieToken(r, auth.SessionCookie); tokenString == "" && session != "" {
+		// Cookies are sent by pages of any site, the token is not
+		if !auth.SameOrigin(r) {
+			http.Error(w, "origin of page must be the same as of the server", http.StatusForbidden)
+			return
+		}
+		tokenString = session
+	}
+	valid, err := auth.ValidateToken(tokenString)
+	if !valid {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	login, err := auth.GetLoginByToken(tokenString)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	socketsMutex.Lock()
+	sockets[conn] = true
+	socketsMutex.Unlock()
+	defer func() {
+		socketsMutex.Lock()
+		delete(sockets, conn)
+		socketsMutex.Unlock()
+		conn.Close()
+	}()
+
+	Touch(login)
+	for {
+		err = conn.SetReadDeadline(time.Now().Add(onlineWindow))
+		if err != nil {
+			return
+		}
+		if _, _, err = conn.ReadMessage(); err != nil {
+			return
+		}
+		Touch(login)
+	}
+}
+
+/**
+Close open sockets on shutdown, server does not
+wait for them as they are hijacked connections
+*/
+func CloseSockets() {
+	socketsMutex.Lock()
+	defer socketsMutex.Unlock()
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down")
+	for conn := range sockets {
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		conn.Close()
+	}
+}
@@ -0,0 +1,146 @@
+package presence
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"social-network-study/config"
+	"social-network-study/metrics"
+	"social-network-study/model/user"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Service for working with Presence of users
+ */
+
+const (
+	maxPresenceIds  = 500
+	maxTrackedUsers = 10000
+)
+
+type Presence struct {
+	UserId   int     `json:"userId"`
+	Online   *bool   `json:"online"`
+	LastSeen *string `json:"lastSeen"`
+}
+
+type Settings struct {
+	UserId int  `json:"userId"`
+	Hidden bool `json:"hidden"`
+}
+
+var touchInterval = 30 * time.Second
+var onlineWindow = 2 * time.Minute
+
+var touchedMutex sync.Mutex
+var touched = make(map[string]time.Time)
+
+func Init(cfg *config.Config) {
+	if cfg.Presence.TouchInterval > 0 {
+		touchInterval = cfg.Presence.TouchInterval
+	}
+	if cfg.Presence.OnlineWindow > 0 {
+		onlineWindow = cfg.Presence.OnlineWindow
+	}
+	user.SetOnlineWindow(onlineWindow)
+}
+
+/**
+Update last seen time of User by login.
+Writes are throttled to one per touch interval
+*/
+func Touch(login string) {
+	now := time.Now()
+	touchedMutex.Lock()
+	last, ok := touched[login]
+	if ok && now.Sub(last) < touchInterval {
+		touchedMutex.Unlock()
+		return
+	}
+	if len(touched) >= maxTrackedUsers {
+		for key, value := range touched {
+			if now.Sub(value) >= touchInterval {
+				delete(touched, key)
+			}
+		}
+	}
+	touched[login] = now
+	touchedMutex.Unlock()
+
+	defer metrics.Measure("presence.Touch")()
+	db := config.PrimaryDataBase()
+	_, err := db.Exec(`INSERT INTO presence(user_id, last_seen) SELECT id, NOW() FROM users WHERE login=?
+							  ON DUPLICATE KEY UPDATE last_seen = VALUES(last_seen)`, login)
+	if err != nil {
+		log.WithField("login", login).WithError(err).Warn("Cannot update presence")
+	}
+}
+
+/* Get presence of several users, hidden users have empty presence */
+func FetchPresence(ids []int) ([]*Presence, error) {
+	defer metrics.Measure("presence.FetchPresence")()
+	presence := make([]*Presence, 0)
+	if len(ids) == 0 {
+		return presence, nil
+	}
+	if len(ids) > maxPresenceIds {
+		return nil, fmt.Errorf("at most %d users can be requested", maxPresenceIds)
+	}
+
+	db := config.DataBase()
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, int(onlineWindow.Seconds()))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := db.Query(fmt.Sprintf(`SELECT u.id,
+								  IF(IFNULL(p.hidden, FALSE), NULL, IFNULL(p.last_seen > NOW() - INTERVAL ? SECOND, FALSE)),
+								  IF(IFNULL(p.hidden, FALSE), NULL, p.last_seen)
+								  FROM users u LEFT JOIN presence p ON p.user_id = u.id
+								  WHERE u.id IN (%s)`, placeholders), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := new(Presence)
+		err = rows.Scan(&item.UserId, &item.Online, &item.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		presence = append(presence, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return presence, nil
+}
+
+/* Save privacy settings of presence */
+func UpdateSettings(settings *Settings) (bool, error) {
+	defer metrics.Measure("presence.UpdateSettings")()
+	db := config.PrimaryDataBase()
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO presence(user_id, hidden) VALUES (?, ?)
+							 ON DUPLICATE KEY UPDATE hidden = VALUES(hidden)`,
+		settings.UserId,
+		settings.Hidden,
+	)
+	if err != nil {
+		return false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -5,9 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
+	"io"
 	"net/http"
 	"social-network-study/model/auth"
 	"strconv"
+	"strings"
 )
 
 /* Authentication */
@@ -18,20 +20,13 @@ func SingIn(writer http.ResponseWriter, request *http.Request) {
 		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
 	}
-	userByLogin, err := CheckPassword(credentials)
+	userByLogin, err := CheckPassword(request.Context(), credentials)
 	if err != nil {
 		writer.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	token, err := auth.CreateToken(userByLogin.Login)
-	if err != nil {
-		http.Error(writer, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	writer.Header().Add("Content-Type", "application/json")
-	writer.Header().Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	writeTokens(writer, userByLogin, http.StatusOK)
 }
 
 /* Register new User */
@@ -42,20 +37,106 @@ func SingUp(writer http.ResponseWriter, request *http.Request) {
 		http.Error(writer, err.Error(), http.StatusBadRequest)
 		return
 	}
-	userSaved, err := Register(userNew)
+	userSaved, err := Register(request.Context(), userNew)
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	token, err := auth.CreateToken(userSaved.Login)
+	writer.Header().Add("Location", fmt.Sprintf("%s/users/%d", apiRoot(request), userSaved.ID))
+	writeTokens(writer, userSaved, http.StatusCreated)
+}
+
+/* Exchange refresh token for new tokens */
+func RefreshSession(writer http.ResponseWriter, request *http.Request) {
+	refresh := new(RefreshRequest)
+	err := json.NewDecoder(request.Body).Decode(refresh)
+	if err != nil && err != io.EOF {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if refresh.RefreshToken == "" {
+		refresh.RefreshToken = auth.CookieToken(request, auth.RefreshCookie)
+		if err = auth.CheckCsrf(request); refresh.RefreshToken != "" && err != nil {
+			http.Error(writer, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+	login, err := auth.GetLoginByRefreshToken(refresh.RefreshToken)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	userByLogin, err := FetchUserByLogin(request.Context(), login)
 	if err != nil {
 		http.Error(writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if userByLogin.ID == 0 {
+		http.Error(writer, "user of token does not exist", http.StatusUnauthorized)
+		return
+	}
+
+	writeTokens(writer, userByLogin, http.StatusOK)
+}
+
+/* End session in cookies, tokens given to clients stay valid until they expire */
+func SignOut(writer http.ResponseWriter, request *http.Request) {
+	// Session in cookies is ended by the same site only
+	signedIn := auth.CookieToken(request, auth.SessionCookie) != "" || auth.CookieToken(request, auth.RefreshCookie) != ""
+	if err := auth.CheckCsrf(request); signedIn && err != nil {
+		http.Error(writer, err.Error(), http.StatusForbidden)
+		return
+	}
+	auth.ClearSessionCookies(writer)
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+/**
+Issue access and refresh tokens of user as OAuth2 token
+response, the access token is also put in Authorization
+header for clients of the former format. Session
+cookies are set as well when they are enabled
+*/
+func writeTokens(writer http.ResponseWriter, user *User, status int) {
+	token, err := auth.CreateToken(user.ID, user.Login)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	refreshToken, err := auth.CreateRefreshToken(user.Login)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if auth.CookiesEnabled() {
+		if err = auth.SetSessionCookies(writer, token, refreshToken); err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	writer.Header().Add("Content-Type", "application/json")
+	writer.Header().Add("Cache-Control", "no-store")
 	writer.Header().Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	writer.WriteHeader(status)
+	err = json.NewEncoder(writer).Encode(&TokenResponse{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTtl().Seconds()),
+		RefreshToken: refreshToken,
+		User: &UserSummary{
+			ID:        user.ID,
+			Login:     user.Login,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+		},
+	})
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
 }
 
 /* Get current user */
@@ -78,7 +159,7 @@ func GetCurrentUser(writer http.ResponseWriter, request *http.Request) {
 func GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
-	user, err := FetchUserById(id)
+	user, err := FetchUserById(r.Context(), id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -95,13 +176,13 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 /* Get friends by id and search string */
 func GetFriends(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
-	id, _ := strconv.Atoi(queryParams["id"][0])
+	id := UserIdParam(r, "id")
 	querySearch, ok := queryParams["search"]
 	var search = ""
 	if ok || len(querySearch) > 0 {
 		search = querySearch[0]
 	}
-	friends, err := FetchFriends(id, search)
+	friends, err := FetchFriends(r.Context(), id, search)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -123,7 +204,7 @@ func GetFullUsers(w http.ResponseWriter, r *http.Request) {
 	if ok || len(querySearch) > 0 {
 		search = querySearch[0]
 	}
-	friends, err := FetchFullUsers(search)
+	friends, err := FetchFullUsers(r.Context(), search, 0)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -140,13 +221,13 @@ func GetFullUsers(w http.ResponseWriter, r *http.Request) {
 /* Get unknown users by user id and search string */
 func GetUnknownUsers(w http.ResponseWriter, r *http.Request) {
 	queryParams := r.URL.Query()
-	id, _ := strconv.Atoi(queryParams["id"][0])
+	id := UserIdParam(r, "id")
 	querySearch, ok := queryParams["search"]
 	var search = ""
 	if ok || len(querySearch) > 0 {
 		search = querySearch[0]
 	}
-	friends, err := FetchUnknownUsers(id, search)
+	friends, err := FetchUnknownUsers(r.Context(), id, search)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -163,7 +244,7 @@ func GetUnknownUsers(w http.ResponseWriter, r *http.Request) {
 func GetCheckLogin(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	login := vars["login"]
-	checked, err := FetchCheckLogin(login)
+	checked, err := FetchCheckLogin(r.Context(), login)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -187,7 +268,7 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	friends, err := DeleteById(id)
+	friends, err := DeleteById(r.Context(), id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -208,6 +289,9 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if id, ok := mux.Vars(r)["id"]; ok {
+		updatedUser.ID, _ = strconv.Atoi(id)
+	}
 
 	err = CheckForbidden(updatedUser.ID, r)
 	if err != nil {
@@ -215,7 +299,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = Update(updatedUser)
+	_, err = Update(r.Context(), updatedUser)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -230,8 +314,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 }
 
 func PostAddFriend(w http.ResponseWriter, r *http.Request) {
-	newFriend := new(Relationship)
-	err := json.NewDecoder(r.Body).Decode(newFriend)
+	newFriend, err := relationshipParam(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -243,7 +326,7 @@ func PostAddFriend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = AddFriend(newFriend)
+	_, err = AddFriend(r.Context(), newFriend)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -257,8 +340,7 @@ func PostAddFriend(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteFriend(w http.ResponseWriter, r *http.Request) {
-	relationship := new(Relationship)
-	err := json.NewDecoder(r.Body).Decode(relationship)
+	relationship, err := relationshipParam(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -270,7 +352,7 @@ func DeleteFriend(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = RemoveFriend(relationship)
+	_, err = RemoveFriend(r.Context(), relationship)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -283,13 +365,49 @@ func DeleteFriend(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+/* Root of API version of request, like /api/v2 */
+func apiRoot(r *http.Request) string {
+	parts := strings.SplitN(r.URL.Path, "/", 4)
+	if len(parts) < 4 {
+		return ""
+	}
+	return "/" + parts[1] + "/" + parts[2]
+}
+
+/* Id of user from path of v2 or from query of v1 */
+func UserIdParam(r *http.Request, query string) int {
+	value, ok := mux.Vars(r)["id"]
+	if !ok {
+		value = r.URL.Query().Get(query)
+	}
+	id, _ := strconv.Atoi(value)
+	return id
+}
+
+/* Relationship from path of v2 or from body of v1 */
+func relationshipParam(r *http.Request) (*Relationship, error) {
+	vars := mux.Vars(r)
+	if friendId, ok := vars["friendId"]; ok {
+		relationship := new(Relationship)
+		relationship.UserId, _ = strconv.Atoi(vars["id"])
+		relationship.FriendId, _ = strconv.Atoi(friendId)
+		return relationship, nil
+	}
+	relationship := new(Relationship)
+	err := json.NewDecoder(r.Body).Decode(relationship)
+	return relationship, err
+}
+
 func GetCurrentPrincipal(request *http.Request) (*User, error) {
-	tokenString := request.Header.Get("Authorization")
-	login, err := auth.GetLoginByToken(tokenString[7:]) //7 corresponds to "Bearer "
+	tokenString := auth.BearerToken(request)
+	if tokenString == "" {
+		return nil, errors.New("bearer token must be present")
+	}
+	login, err := auth.GetLoginByToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
-	userByLogin, err := FetchUserByLogin(login)
+	userByLogin, err := FetchUserByLogin(request.Context(), login)
 	if err != nil {
 		return nil, err
 	}
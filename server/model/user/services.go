@@ -1,10 +1,14 @@
 package user
 
 import (
+	"context"
 	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"social-network-study/config"
+	"social-network-study/metrics"
+	"social-network-study/tracing"
 	"strings"
+	"time"
 )
 
 /**
@@ -21,6 +25,8 @@ type User struct {
 	Gender    *string `json:"gender"`
 	Interests *string `json:"interests"`
 	City      *string `json:"city"`
+	Online    *bool   `json:"online"`
+	LastSeen  *string `json:"lastSeen"`
 }
 
 type Friend struct {
@@ -29,6 +35,8 @@ type Friend struct {
 	LastName  string  `json:"lastName"`
 	City      *string `json:"city"`
 	IsNew     bool    `json:"isNew"`
+	Online    *bool   `json:"online"`
+	LastSeen  *string `json:"lastSeen"`
 }
 
 type Relationship struct {
@@ -41,10 +49,57 @@ type Credentials struct {
 	Password string `json:"password"`
 }
 
+/* Tokens of signed in user, field names follow OAuth2 token response */
+type TokenResponse struct {
+	AccessToken  string       `json:"access_token"`
+	TokenType    string       `json:"token_type"`
+	ExpiresIn    int          `json:"expires_in"`
+	RefreshToken string       `json:"refresh_token"`
+	User         *UserSummary `json:"user"`
+}
+
+type UserSummary struct {
+	ID        int    `json:"id"`
+	Login     string `json:"login"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+/* Users seen within this window are online */
+var onlineWindow = 2 * time.Minute
+
+/* Largest page of search of all users */
+const maxFullUsers = 100
+
+/* Backslash is the default escape character of LIKE in MySQL */
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+/* Presence columns of users joined with presence p, empty for hidden users */
+const presenceColumns = `IF(IFNULL(p.hidden, FALSE), NULL, IFNULL(p.last_seen > NOW() - INTERVAL ? SECOND, FALSE)),
+								  IF(IFNULL(p.hidden, FALSE), NULL, p.last_seen)`
+
+func SetOnlineWindow(window time.Duration) {
+	if window > 0 {
+		onlineWindow = window
+	}
+}
+
+func onlineSeconds() int {
+	return int(onlineWindow.Seconds())
+}
+
 /*	Get User by Id */
-func FetchUserById(id int) (*User, error) {
+func FetchUserById(ctx context.Context, id int) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchUserById")
+	defer span.End()
+	defer metrics.Measure("user.FetchUserById")()
 	db := config.DataBase()
-	rows, err := db.Query("SELECT id, login, firstName, lastName, birthDay, gender, interests, city FROM users WHERE id=?", id)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT u.id, u.login, u.firstName, u.lastName, u.birthDay, u.gender, u.interests, u.city, %s
+								  FROM users u LEFT JOIN presence p ON p.user_id = u.id WHERE u.id=?`, presenceColumns), onlineSeconds(), id)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +115,8 @@ func FetchUserById(id int) (*User, error) {
 			&user.Gender,
 			&user.Interests,
 			&user.City,
+			&user.Online,
+			&user.LastSeen,
 		)
 		if err != nil {
 			return nil, err
@@ -72,9 +129,13 @@ func FetchUserById(id int) (*User, error) {
 }
 
 /* Get User by SingIn */
-func FetchUserByLogin(login string) (*User, error) {
+func FetchUserByLogin(ctx context.Context, login string) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchUserByLogin")
+	defer span.End()
+	defer metrics.Measure("user.FetchUserByLogin")()
 	db := config.DataBase()
-	rows, err := db.Query("SELECT id, login, firstName, lastName, birthDay, gender, interests, city FROM users WHERE login=?", login)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT u.id, u.login, u.firstName, u.lastName, u.birthDay, u.gender, u.interests, u.city, %s
+								  FROM users u LEFT JOIN presence p ON p.user_id = u.id WHERE u.login=?`, presenceColumns), onlineSeconds(), login)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +152,8 @@ func FetchUserByLogin(login string) (*User, error) {
 			&user.Gender,
 			&user.Interests,
 			&user.City,
+			&user.Online,
+			&user.LastSeen,
 		)
 		if err != nil {
 			return nil, err
@@ -103,9 +166,12 @@ func FetchUserByLogin(login string) (*User, error) {
 }
 
 /* Check Login */
-func FetchCheckLogin(login string) (bool, error) {
+func FetchCheckLogin(ctx context.Context, login string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchCheckLogin")
+	defer span.End()
+	defer metrics.Measure("user.FetchCheckLogin")()
 	db := config.DataBase()
-	rows, err := db.Query("SELECT login FROM users WHERE login=?", login)
+	rows, err := db.QueryContext(ctx, "SELECT login FROM users WHERE login=?", login)
 	if err != nil {
 		return false, err
 	}
@@ -118,16 +184,21 @@ func FetchCheckLogin(login string) (bool, error) {
 }
 
 /* Get New Friends by Search */
-func FetchFriends(id int, search string) ([]*Friend, error) {
+func FetchFriends(ctx context.Context, id int, search string) ([]*Friend, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchFriends")
+	defer span.End()
+	defer metrics.Measure("user.FetchFriends")()
 	db := config.DataBase()
-	var str strings.Builder
+	condition := ""
+	args := []interface{}{onlineSeconds(), id}
 	if search != "" {
-		str.WriteString("AND (LOWER(u.firstName) LIKE '" + strings.ToLower(search) + "%' ")
-		str.WriteString("OR LOWER(u.lastName) LIKE '" + strings.ToLower(search) + "%')")
+		condition = "AND (LOWER(u.firstName) LIKE ? OR LOWER(u.lastName) LIKE ?)"
+		args = append(args, prefixPattern(search), prefixPattern(search))
 	}
-	rows, err := db.Query(fmt.Sprintf(`SELECT id, firstName, lastName, city 
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT id, firstName, lastName, city, %s 
 								  FROM users u LEFT JOIN friends f ON u.id = f.user_id 
-                                  WHERE f.friend_id=? %s`, str.String()), id)
+								  LEFT JOIN presence p ON p.user_id = u.id 
+                                  WHERE f.friend_id=? %s`, presenceColumns, condition), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +207,7 @@ func FetchFriends(id int, search string) ([]*Friend, error) {
 	friends := make([]*Friend, 0)
 	for rows.Next() {
 		friend := new(Friend)
-		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName, &friend.City)
+		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName, &friend.City, &friend.Online, &friend.LastSeen)
 		if err != nil {
 			return nil, err
 		}
@@ -148,16 +219,165 @@ func FetchFriends(id int, search string) ([]*Friend, error) {
 	return friends, nil
 }
 
-/* Get all users by search string */
-func FetchFullUsers(search string) ([]*Friend, error) {
+/* Get users by list of ids */
+func FetchFriendsByIds(ctx context.Context, ids []int) ([]*Friend, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchFriendsByIds")
+	defer span.End()
+	defer metrics.Measure("user.FetchFriendsByIds")()
+	friends := make([]*Friend, 0)
+	if len(ids) == 0 {
+		return friends, nil
+	}
 	db := config.DataBase()
-	var str strings.Builder
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT id, firstName, lastName, city, %s 
+								  FROM users u LEFT JOIN presence p ON p.user_id = u.id 
+								  WHERE id IN (%s)`, presenceColumns, placeholders), append([]interface{}{onlineSeconds()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		friend := new(Friend)
+		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName, &friend.City, &friend.Online, &friend.LastSeen)
+		if err != nil {
+			return nil, err
+		}
+		friends = append(friends, friend)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return friends, nil
+}
+
+/* Get full users by list of ids, in one query */
+func FetchUsersByIds(ctx context.Context, ids []int) ([]*User, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchUsersByIds")
+	defer span.End()
+	defer metrics.Measure("user.FetchUsersByIds")()
+	users := make([]*User, 0)
+	if len(ids) == 0 {
+		return users, nil
+	}
+	db := config.DataBase()
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT u.id, u.login, u.firstName, u.lastName, u.birthDay, u.gender, u.interests, u.city, %s
+								  FROM users u LEFT JOIN presence p ON p.user_id = u.id
+								  WHERE u.id IN (%s)`, presenceColumns, placeholders), append([]interface{}{onlineSeconds()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := new(User)
+		err = rows.Scan(
+			&user.ID,
+			&user.Login,
+			&user.FirstName,
+			&user.LastName,
+			&user.BirthDay,
+			&user.Gender,
+			&user.Interests,
+			&user.City,
+			&user.Online,
+			&user.LastSeen,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+/* Get full friends of every user of the list, in one query */
+func FetchFriendsOfUsers(ctx context.Context, ids []int) (map[int][]*User, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchFriendsOfUsers")
+	defer span.End()
+	defer metrics.Measure("user.FetchFriendsOfUsers")()
+	friends := make(map[int][]*User, len(ids))
+	if len(ids) == 0 {
+		return friends, nil
+	}
+	db := config.DataBase()
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT f.friend_id, u.id, u.login, u.firstName, u.lastName, u.birthDay, u.gender, u.interests, u.city, %s
+								  FROM friends f INNER JOIN users u ON u.id = f.user_id
+								  LEFT JOIN presence p ON p.user_id = u.id
+								  WHERE f.friend_id IN (%s) ORDER BY u.id`, presenceColumns, placeholders), append([]interface{}{onlineSeconds()}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var of int
+		user := new(User)
+		err = rows.Scan(
+			&of,
+			&user.ID,
+			&user.Login,
+			&user.FirstName,
+			&user.LastName,
+			&user.BirthDay,
+			&user.Gender,
+			&user.Interests,
+			&user.City,
+			&user.Online,
+			&user.LastSeen,
+		)
+		if err != nil {
+			return nil, err
+		}
+		friends[of] = append(friends[of], user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return friends, nil
+}
+
+/**
+Get users whose first and last names both start with search,
+all users when it is empty. At most limit of them are listed,
+the largest page when it is 0
+*/
+func FetchFullUsers(ctx context.Context, search string, limit int) ([]*Friend, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchFullUsers")
+	defer span.End()
+	defer metrics.Measure("user.FetchFullUsers")()
+	if limit <= 0 || limit > maxFullUsers {
+		limit = maxFullUsers
+	}
+	db := config.DataBase()
+	condition := "TRUE"
+	args := []interface{}{onlineSeconds()}
 	if search != "" {
-		str.WriteString("lower(firstName) LIKE '" + strings.ToLower(search) + "%' ")
-		str.WriteString("AND lower(lastName) LIKE '" + strings.ToLower(search) + "%'")
+		condition = "lower(firstName) LIKE ? AND lower(lastName) LIKE ?"
+		args = append(args, prefixPattern(search), prefixPattern(search))
 	}
-	rows, err := db.Query(fmt.Sprintf(`SELECT id, firstName, lastName 
-								  FROM users WHERE %s ORDER BY id LIMIT 100`, str.String()))
+	args = append(args, limit)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT id, firstName, lastName, %s 
+								  FROM users u LEFT JOIN presence p ON p.user_id = u.id 
+								  WHERE %s ORDER BY id LIMIT ?`, presenceColumns, condition), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +386,7 @@ func FetchFullUsers(search string) ([]*Friend, error) {
 	friends := make([]*Friend, 0)
 	for rows.Next() {
 		friend := new(Friend)
-		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName)
+		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName, &friend.Online, &friend.LastSeen)
 		if err != nil {
 			return nil, err
 		}
@@ -180,17 +400,23 @@ func FetchFullUsers(search string) ([]*Friend, error) {
 }
 
 /* Get unknown users by user id and search string */
-func FetchUnknownUsers(id int, search string) ([]*Friend, error) {
+func FetchUnknownUsers(ctx context.Context, id int, search string) ([]*Friend, error) {
+	ctx, span := tracing.Start(ctx, "user.FetchUnknownUsers")
+	defer span.End()
+	defer metrics.Measure("user.FetchUnknownUsers")()
 	db := config.DataBase()
-	var str strings.Builder
+	condition := "TRUE"
+	args := []interface{}{onlineSeconds()}
 	if search != "" {
-		str.WriteString("lower(firstName) LIKE '" + strings.ToLower(search) + "%' ")
-		str.WriteString("OR lower(lastName) LIKE '" + strings.ToLower(search) + "%'")
+		condition = "(lower(firstName) LIKE ? OR lower(lastName) LIKE ?)"
+		args = append(args, prefixPattern(search), prefixPattern(search))
 	}
-	rows, err := db.Query(fmt.Sprintf(`SELECT id, firstName, lastName, city 
-								  FROM users WHERE %s AND id <> ? AND id not in 
+	args = append(args, id, id)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT id, firstName, lastName, city, %s 
+								  FROM users LEFT JOIN presence p ON p.user_id = users.id 
+								  WHERE %s AND id <> ? AND id not in 
                                   (SELECT u.id FROM users u INNER JOIN friends f on u.id = f.user_id 
-	                              WHERE f.friend_id = ?) limit 100`, str.String()), id, id)
+	                              WHERE f.friend_id = ?) limit 100`, presenceColumns, condition), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -199,7 +425,7 @@ func FetchUnknownUsers(id int, search string) ([]*Friend, error) {
 	friends := make([]*Friend, 0)
 	for rows.Next() {
 		friend := new(Friend)
-		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName, &friend.City)
+		err = rows.Scan(&friend.ID, &friend.FirstName, &friend.LastName, &friend.City, &friend.Online, &friend.LastSeen)
 		if err != nil {
 			return nil, err
 		}
@@ -212,16 +438,27 @@ func FetchUnknownUsers(id int, search string) ([]*Friend, error) {
 	return friends, nil
 }
 
+/**
+Pattern of LIKE for names starting with search,
+wildcards typed in search are matched literally
+*/
+func prefixPattern(search string) string {
+	return likeEscaper.Replace(strings.ToLower(search)) + "%"
+}
+
 /* Register new User */
-func Register(user *User) (*User, error) {
-	db := config.DataBase()
-	tx, err := db.Begin()
+func Register(ctx context.Context, user *User) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.Register")
+	defer span.End()
+	defer metrics.Measure("user.Register")()
+	db := config.PrimaryDataBase()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := db.Prepare("INSERT INTO users(login, password, firstName, lastName, birthDay) VALUES (?,?,?,?,?)")
+	stmt, err := db.PrepareContext(ctx, "INSERT INTO users(login, password, firstName, lastName, birthDay) VALUES (?,?,?,?,?)")
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +471,7 @@ func Register(user *User) (*User, error) {
 
 	password := string(hashedPassword)
 
-	exec, err := stmt.Exec(user.Login, password, user.FirstName, user.LastName, user.BirthDay)
+	exec, err := stmt.ExecContext(ctx, user.Login, password, user.FirstName, user.LastName, user.BirthDay)
 	if err != nil {
 		return nil, err
 	}
@@ -254,21 +491,24 @@ func Register(user *User) (*User, error) {
 }
 
 /* Update base information about User */
-func Update(user *User) (bool, error) {
-	db := config.DataBase()
-	tx, err := db.Begin()
+func Update(ctx context.Context, user *User) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.Update")
+	defer span.End()
+	defer metrics.Measure("user.Update")()
+	db := config.PrimaryDataBase()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return false, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := db.Prepare("UPDATE users SET login=?, firstName=?, lastName=?, birthDay=?, gender=?, interests=?, city=? WHERE id=?")
+	stmt, err := db.PrepareContext(ctx, "UPDATE users SET login=?, firstName=?, lastName=?, birthDay=?, gender=?, interests=?, city=? WHERE id=?")
 	if err != nil {
 		return false, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(
+	_, err = stmt.ExecContext(ctx,
 		&user.Login,
 		&user.FirstName,
 		&user.LastName,
@@ -289,28 +529,31 @@ func Update(user *User) (bool, error) {
 }
 
 /* Add friend for User */
-func AddFriend(relationship *Relationship) (bool, error) {
-	db := config.DataBase()
-	tx, err := db.Begin()
+func AddFriend(ctx context.Context, relationship *Relationship) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.AddFriend")
+	defer span.End()
+	defer metrics.Measure("user.AddFriend")()
+	db := config.PrimaryDataBase()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return false, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := db.Prepare("INSERT INTO friends(user_id, friend_id) VALUES (?, ?)")
+	stmt, err := db.PrepareContext(ctx, "INSERT INTO friends(user_id, friend_id) VALUES (?, ?)")
 	if err != nil {
 		return false, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(
+	_, err = stmt.ExecContext(ctx,
 		relationship.UserId,
 		relationship.FriendId,
 	)
 	if err != nil {
 		return false, err
 	}
-	_, err = stmt.Exec(
+	_, err = stmt.ExecContext(ctx,
 		relationship.FriendId,
 		relationship.UserId,
 	)
@@ -326,27 +569,30 @@ func AddFriend(relationship *Relationship) (bool, error) {
 }
 
 /* Remove friend for User */
-func RemoveFriend(relationship *Relationship) (bool, error) {
-	db := config.DataBase()
-	tx, err := db.Begin()
+func RemoveFriend(ctx context.Context, relationship *Relationship) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.RemoveFriend")
+	defer span.End()
+	defer metrics.Measure("user.RemoveFriend")()
+	db := config.PrimaryDataBase()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return false, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := db.Prepare("DELETE FROM friends WHERE user_id=? AND friend_id=?")
+	stmt, err := db.PrepareContext(ctx, "DELETE FROM friends WHERE user_id=? AND friend_id=?")
 	if err != nil {
 		return false, err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(
+	_, err = stmt.ExecContext(ctx,
 		relationship.UserId,
 		relationship.FriendId,
 	)
 	if err != nil {
 		return false, err
 	}
-	_, err = stmt.Exec(
+	_, err = stmt.ExecContext(ctx,
 		relationship.FriendId,
 		relationship.UserId,
 	)
@@ -361,21 +607,24 @@ func RemoveFriend(relationship *Relationship) (bool, error) {
 }
 
 /* Delete User by Id */
-func DeleteById(id int) (bool, error) {
-	db := config.DataBase()
-	tx, err := db.Begin()
+func DeleteById(ctx context.Context, id int) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.DeleteById")
+	defer span.End()
+	defer metrics.Measure("user.DeleteById")()
+	db := config.PrimaryDataBase()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return false, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := db.Prepare("DELETE FROM users WHERE id=?")
+	stmt, err := db.PrepareContext(ctx, "DELETE FROM users WHERE id=?")
 	if err != nil {
 		return false, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	_, err = stmt.ExecContext(ctx, id)
 	if err != nil {
 		return false, err
 	}
@@ -387,9 +636,12 @@ func DeleteById(id int) (bool, error) {
 }
 
 /* Check Password */
-func CheckPassword(credentials *Credentials) (*User, error) {
+func CheckPassword(ctx context.Context, credentials *Credentials) (*User, error) {
+	ctx, span := tracing.Start(ctx, "user.CheckPassword")
+	defer span.End()
+	defer metrics.Measure("user.CheckPassword")()
 	db := config.DataBase()
-	rows, err := db.Query("SELECT * FROM users WHERE login=?", credentials.Login)
+	rows, err := db.QueryContext(ctx, "SELECT * FROM users WHERE login=?", credentials.Login)
 	if err != nil {
 		return nil, err
 	}
@@ -423,3 +675,25 @@ func CheckPassword(credentials *Credentials) (*User, error) {
 	user.Password = ""
 	return user, nil
 }
+
+/* Set new Password of User by login, false when there is no such User */
+func ResetPassword(ctx context.Context, credentials *Credentials) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.ResetPassword")
+	defer span.End()
+	defer metrics.Measure("user.ResetPassword")()
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return false, err
+	}
+
+	db := config.PrimaryDataBase()
+	exec, err := db.ExecContext(ctx, "UPDATE users SET password=? WHERE login=?", string(hashedPassword), credentials.Login)
+	if err != nil {
+		return false, err
+	}
+	affected, err := exec.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
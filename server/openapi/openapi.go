@@ -0,0 +1,200 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"social-network-study/config"
+	"strings"
+)
+
+/**
+ * OpenAPI document of the REST API and validation of requests
+ * and responses against it, which catches drift between the
+ * document and handlers in tests and development
+ */
+
+var document []byte
+var validator func(http.Handler) http.Handler
+
+/* Load document and, when enabled, the validation of requests */
+func Init(cfg *config.Config) {
+	spec, err := Load(cfg.Server.OpenAPI)
+	if err != nil {
+		log.Fatalf("Cannot load OpenAPI document... %v", err)
+	}
+	document, err = json.Marshal(spec)
+	if err != nil {
+		log.Fatalf("Cannot encode OpenAPI document... %v", err)
+	}
+	if cfg.Server.ValidateAPI {
+		validator = Validator(spec, logViolation)
+		log.WithField("file", cfg.Server.OpenAPI).Info("Requests are validated against OpenAPI document")
+	}
+}
+
+/* Load and check OpenAPI document from YAML or JSON file */
+func Load(path string) (*openapi3.Swagger, error) {
+	spec, err := openapi3.NewSwaggerLoader().LoadSwaggerFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = spec.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+/* Serve OpenAPI document as JSON */
+func GetDocument(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(document)
+}
+
+/* Middleware validating requests when it is enabled in config */
+func Middleware(next http.Handler) http.Handler {
+	if validator == nil {
+		return next
+	}
+	return validator(next)
+}
+
+func logViolation(r *http.Request, err error) {
+	log.WithFields(log.Fields{"method": r.Method, "path": r.URL.Path}).WithError(err).Warn("Violation of OpenAPI document")
+}
+
+/**
+Middleware validating requests and responses against document.
+Violations are reported and do not change the response, so
+tests may fail on them while the server keeps serving
+*/
+func Validator(spec *openapi3.Swagger, report func(r *http.Request, err error)) func(http.Handler) http.Handler {
+	return validate(spec, report, false)
+}
+
+/**
+Middleware rejecting violations of document after reporting
+them. Undocumented routes get 404, invalid requests get 400
+without reaching handlers and invalid responses are replaced
+by 500, so tests see them as failed requests
+*/
+func StrictValidator(spec *openapi3.Swagger, report func(r *http.Request, err error)) func(http.Handler) http.Handler {
+	return validate(spec, report, true)
+}
+
+func validate(spec *openapi3.Swagger, report func(r *http.Request, err error), strict bool) func(http.Handler) http.Handler {
+	router := openapi3filter.NewRouter().WithSwagger(spec)
+	options := &openapi3filter.Options{AuthenticationFunc: authenticate, IncludeResponseStatus: true}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r.Method, r.URL)
+			if err != nil {
+				err = fmt.Errorf("route is not documented: %v", err)
+				report(r, err)
+				if strict {
+					http.Error(w, err.Error(), http.StatusNotFound)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+			input := &openapi3filter.RequestValidationInput{Request: r, PathParams: pathParams, Route: route, Options: options}
+			if err = openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+				err = fmt.Errorf("invalid request: %v", err)
+				report(r, err)
+				if strict {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			if strings.EqualFold(r.Header.Get("Connection"), "upgrade") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Strict validation holds the response back until it is checked
+			recorder := &bodyRecorder{ResponseWriter: w, status: http.StatusOK, buffered: strict}
+			next.ServeHTTP(recorder, r)
+			output := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: input,
+				Status:                 recorder.status,
+				Header:                 w.Header(),
+				Options:                options,
+			}
+			err = openapi3filter.ValidateResponse(r.Context(), output.SetBodyBytes(recorder.body.Bytes()))
+			if err != nil {
+				err = fmt.Errorf("invalid response: %v", err)
+				report(r, err)
+				if strict {
+					w.Header().Del("Content-Length")
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+			if strict {
+				recorder.flush()
+			}
+		})
+	}
+}
+
+/* Token must be present, it is checked by handlers */
+func authenticate(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+	r := input.RequestValidationInput.Request
+	scheme := input.SecurityScheme
+	switch {
+	case scheme.Type == "http" && strings.EqualFold(scheme.Scheme, "bearer"):
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			return nil
+		}
+	case scheme.Type == "apiKey" && scheme.In == "query":
+		if r.URL.Query().Get(scheme.Name) != "" {
+			return nil
+		}
+	case scheme.Type == "apiKey" && scheme.In == "cookie":
+		if cookie, err := r.Cookie(scheme.Name); err == nil && cookie.Value != "" {
+			return nil
+		}
+	}
+	return input.NewError(errors.New("token is missing"))
+}
+
+/* Response passed through, or buffered, and kept for validation */
+type bodyRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buffered    bool
+	body        bytes.Buffer
+}
+
+func (r *bodyRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	if !r.buffered {
+		r.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (r *bodyRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(data)
+	if r.buffered {
+		return len(data), nil
+	}
+	return r.ResponseWriter.Write(data)
+}
+
+/* Send buffered response */
+func (r *bodyRecorder) flush() {
+	r.ResponseWriter.WriteHeader(r.status)
+	r.ResponseWriter.Write(r.body.Bytes())
+}
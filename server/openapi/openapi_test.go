@@ -0,0 +1,125 @@
+package openapi
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testDocument = `
+openapi: 3.0.0
+info:
+  title: Test
+  version: "1"
+paths:
+  /items/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+    get:
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            maximum: 100
+      responses:
+        '200':
+          description: Item
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id:
+                    type: integer
+`
+
+func loadTestDocument(t *testing.T) *openapi3.Swagger {
+	spec, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(testDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec
+}
+
+/* Handler answering with the given status and body */
+func respond(status int, body string, called *bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*called = true
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+}
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		name       string
+		target     string
+		status     int
+		body       string
+		violation  string
+		strictCode int
+	}{
+		{"valid", "/items/1?limit=10", http.StatusOK, `{"id":1}`, "", http.StatusOK},
+		{"query of wrong type", "/items/1?limit=ten", http.StatusOK, `{"id":1}`, "invalid request", http.StatusBadRequest},
+		{"query beyond maximum", "/items/1?limit=1000", http.StatusOK, `{"id":1}`, "invalid request", http.StatusBadRequest},
+		{"path of wrong type", "/items/one", http.StatusOK, `{"id":1}`, "invalid request", http.StatusBadRequest},
+		{"body of wrong type", "/items/1", http.StatusOK, `{"id":"one"}`, "invalid response", http.StatusInternalServerError},
+		{"body without required field", "/items/1", http.StatusOK, `{}`, "invalid response", http.StatusInternalServerError},
+		{"undocumented status", "/items/1", http.StatusNotFound, `{"id":1}`, "invalid response", http.StatusInternalServerError},
+		{"undocumented route", "/things/1", http.StatusOK, `{"id":1}`, "route is not documented", http.StatusNotFound},
+	}
+	spec := loadTestDocument(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := make([]string, 0)
+			report := func(r *http.Request, err error) {
+				violations = append(violations, err.Error())
+			}
+
+			called := false
+			recorder := httptest.NewRecorder()
+			Validator(spec, report)(respond(test.status, test.body, &called)).ServeHTTP(recorder, httptest.NewRequest("GET", test.target, nil))
+			if !called || recorder.Code != test.status || recorder.Body.String() != test.body {
+				t.Errorf("Validator() changed response to %d %q, handler called %v", recorder.Code, recorder.Body.String(), called)
+			}
+			checkViolations(t, violations, test.violation)
+
+			violations = violations[:0]
+			called = false
+			recorder = httptest.NewRecorder()
+			StrictValidator(spec, report)(respond(test.status, test.body, &called)).ServeHTTP(recorder, httptest.NewRequest("GET", test.target, nil))
+			if recorder.Code != test.strictCode {
+				t.Errorf("StrictValidator() status = %d, want %d", recorder.Code, test.strictCode)
+			}
+			if test.strictCode == test.status && recorder.Body.String() != test.body {
+				t.Errorf("StrictValidator() body = %q, want %q", recorder.Body.String(), test.body)
+			}
+			if reachesHandler := test.strictCode == test.status || test.strictCode == http.StatusInternalServerError; called != reachesHandler {
+				t.Errorf("StrictValidator() called handler %v, want %v", called, reachesHandler)
+			}
+			checkViolations(t, violations, test.violation)
+		})
+	}
+}
+
+func checkViolations(t *testing.T, violations []string, want string) {
+	t.Helper()
+	if want == "" {
+		if len(violations) > 0 {
+			t.Errorf("violations = %q, want none", violations)
+		}
+		return
+	}
+	if len(violations) != 1 || !strings.HasPrefix(violations[0], want) {
+		t.Errorf("violations = %q, want one starting with %q", violations, want)
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+/* Limit of requests per period, they may be spent in a burst */
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+/* Bucket of tokens as it was at update time */
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+/* Outcome of taking a token of bucket */
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Time until the bucket is full again
+	Reset time.Duration
+	// Time until the next token, zero when allowed
+	RetryAfter time.Duration
+}
+
+/**
+Storage of buckets by key. Shared stores let instances
+of the server enforce limits together
+*/
+type Store interface {
+	// Take a token of bucket of key, missing bucket is full
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+/* Bucket which has not been used yet */
+func (l Limit) Full(now time.Time) Bucket {
+	return Bucket{Tokens: float64(l.Requests), Updated: now}
+}
+
+/**
+Refill bucket for the time passed since its update
+and take a token of it when there is a whole one
+*/
+func (l Limit) Take(bucket Bucket, now time.Time) (Bucket, Result) {
+	perToken := float64(l.Period) / float64(l.Requests)
+	// Clocks of instances sharing a store may disagree a little
+	elapsed := now.Sub(bucket.Updated)
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	tokens := math.Min(float64(l.Requests), bucket.Tokens+float64(elapsed)/perToken)
+
+	result := Result{Allowed: tokens >= 1}
+	if result.Allowed {
+		tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * perToken)
+	}
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration((float64(l.Requests) - tokens) * perToken)
+	return Bucket{Tokens: tokens, Updated: now}, result
+}
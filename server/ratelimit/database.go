@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+/**
+Buckets in the database shared by instances. A bucket is
+locked by the transaction taking its token, times are kept
+as unix nanoseconds to be independent of time zones
+*/
+type databaseStore struct {
+	db        *sql.DB
+	mutex     sync.Mutex
+	nextSweep time.Time
+}
+
+func NewDatabaseStore(db *sql.DB) Store {
+	return &databaseStore{db: db}
+}
+
+func (s *databaseStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.sweepSometimes(now)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	full := limit.Full(now)
+	_, err = tx.ExecContext(ctx, `INSERT IGNORE INTO rate_limits (bucket, tokens, updated_ns, full_ns)
+								  VALUES (?, ?, ?, ?)`, key, full.Tokens, now.UnixNano(), now.UnixNano())
+	if err != nil {
+		return Result{}, err
+	}
+
+	var bucket Bucket
+	var updated int64
+	err = tx.QueryRowContext(ctx, `SELECT tokens, updated_ns FROM rate_limits WHERE bucket = ? FOR UPDATE`, key).
+		Scan(&bucket.Tokens, &updated)
+	if err != nil {
+		return Result{}, err
+	}
+	bucket.Updated = time.Unix(0, updated)
+
+	bucket, result := limit.Take(bucket, now)
+	_, err = tx.ExecContext(ctx, `UPDATE rate_limits SET tokens = ?, updated_ns = ?, full_ns = ? WHERE bucket = ?`,
+		bucket.Tokens, bucket.Updated.UnixNano(), now.Add(result.Reset).UnixNano(), key)
+	if err != nil {
+		return Result{}, err
+	}
+	return result, tx.Commit()
+}
+
+/* Delete full buckets in background once in sweep interval */
+func (s *databaseStore) sweepSometimes(now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if now.Before(s.nextSweep) {
+		return
+	}
+	s.nextSweep = now.Add(sweepInterval)
+	go func() {
+		_, err := s.db.Exec(`DELETE FROM rate_limits WHERE full_ns < ?`, now.UnixNano())
+		if err != nil {
+			log.WithError(err).Warn("Cannot delete full rate limit buckets")
+		}
+	}()
+}
@@ -0,0 +1,52 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/* Full buckets are dropped from memory this often */
+const sweepInterval = time.Minute
+
+type memoryBucket struct {
+	Bucket
+	full time.Time
+}
+
+/* Buckets of this instance only */
+type memoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]memoryBucket
+	nextSweep time.Time
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: make(map[string]memoryBucket)}
+}
+
+func (s *memoryStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if now.After(s.nextSweep) {
+		s.sweep(now)
+		s.nextSweep = now.Add(sweepInterval)
+	}
+	current, ok := s.buckets[key]
+	if !ok {
+		current.Bucket = limit.Full(now)
+	}
+	bucket, result := limit.Take(current.Bucket, now)
+	s.buckets[key] = memoryBucket{Bucket: bucket, full: now.Add(result.Reset)}
+	return result, nil
+}
+
+/* Full buckets are the same as missing ones */
+func (s *memoryStore) sweep(now time.Time) {
+	for key, bucket := range s.buckets {
+		if !bucket.full.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"math"
+	"net"
+	"net/http"
+	"social-network-study/config"
+	"social-network-study/logging"
+	"social-network-study/model/auth"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * Token bucket limits of requests to routes by user or
+ * address of client. Policies of config are checked in
+ * order, the first one matching route of request applies
+ */
+
+const (
+	keyUser = "user"
+	keyIp   = "ip"
+)
+
+var enabled bool
+var policies []config.RatePolicy
+var trustedProxies []*net.IPNet
+var store Store = NewMemoryStore()
+
+func Init(cfg *config.Config) {
+	enabled = cfg.RateLimit.Enabled
+	policies = cfg.RateLimit.Policies
+	trustedProxies = make([]*net.IPNet, 0, len(cfg.RateLimit.TrustedProxies))
+	for _, proxy := range cfg.RateLimit.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			trustedProxies = append(trustedProxies, network)
+		}
+	}
+	if cfg.RateLimit.Store == "database" {
+		store = NewDatabaseStore(config.PrimaryDataBase())
+	}
+}
+
+/* Replace store of buckets, e.g. by one of a cache shared by instances */
+func UseStore(s Store) {
+	store = s
+}
+
+/**
+Take a token of policy of the route for user or client,
+requests beyond the limit are rejected with 429. Failing
+store does not reject requests, limits are skipped then
+*/
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		policy := policyOf(request)
+		if !enabled || policy == nil {
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		limit := Limit{Requests: policy.Limit, Period: policy.Period}
+		key := policy.Name + ":" + keyOf(request, policy.Key)
+		result, err := store.Take(request.Context(), key, limit, time.Now())
+		if err != nil {
+			logging.FromContext(request.Context()).WithError(err).Warn("Cannot take token of rate limit")
+			next.ServeHTTP(writer, request)
+			return
+		}
+
+		header := writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", seconds(result.Reset))
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", policy.Limit, seconds(policy.Period)))
+		if !result.Allowed {
+			header.Set("Retry-After", seconds(result.RetryAfter))
+			http.Error(writer, "too many requests, retry later", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+/* The first policy matching route and method of request */
+func policyOf(request *http.Request) *config.RatePolicy {
+	route := mux.CurrentRoute(request)
+	if route == nil {
+		return nil
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	for i := range policies {
+		policy := &policies[i]
+		if matchesMethod(policy.Methods, request.Method) && matchesRoute(policy.Routes, template) {
+			return policy
+		}
+	}
+	return nil
+}
+
+func matchesMethod(methods []string, method string) bool {
+	for _, item := range methods {
+		if strings.EqualFold(item, method) {
+			return true
+		}
+	}
+	return len(methods) == 0
+}
+
+func matchesRoute(routes []string, template string) bool {
+	for _, route := range routes {
+		if route == template || strings.HasSuffix(route, "*") && strings.HasPrefix(template, route[:len(route)-1]) {
+			return true
+		}
+	}
+	return len(routes) == 0
+}
+
+/**
+Key of bucket. Users are recognized by valid token of
+header or session cookie, anonymous requests and requests
+of ip policies are keyed by address of client
+*/
+func keyOf(request *http.Request, kind string) string {
+	if kind == keyUser {
+		token := auth.CookieToken(request, auth.SessionCookie)
+		if header := request.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			token = header[7:] //7 corresponds to "Bearer "
+		}
+		if id, err := auth.GetUserIdByToken(token); err == nil {
+			return keyUser + ":" + strconv.Itoa(id)
+		}
+	}
+	return keyIp + ":" + clientIp(request)
+}
+
+/**
+Address of client. Behind trusted proxies it is the last
+address of X-Forwarded-For which is not a trusted proxy.
+IPv6 clients own whole /64 networks, so they are limited
+by network
+*/
+func clientIp(request *http.Request) string {
+	host := remoteHost(request)
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0 && trusted(ip); i-- {
+		previous := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if previous == nil {
+			// Only trusted proxies vouch for addresses, this one is not an address
+			break
+		}
+		ip = previous
+	}
+
+	if ip.To4() == nil {
+		ip = ip.Mask(net.CIDRMask(64, 128))
+	}
+	return ip.String()
+}
+
+/**
+Request comes directly from a trusted proxy, so
+headers it forwards about the client are believed
+*/
+func FromTrustedProxy(request *http.Request) bool {
+	ip := net.ParseIP(remoteHost(request))
+	return ip != nil && trusted(ip)
+}
+
+func remoteHost(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
+
+func trusted(ip net.IP) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+/* Seconds of header, rounded up so that clients do not come back early */
+func seconds(duration time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(duration.Seconds())))
+}
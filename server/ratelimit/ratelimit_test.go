@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"social-network-study/config"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func TestTakeRefillsByElapsedTime(t *testing.T) {
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+	bucket, result := limit.Take(Bucket{Tokens: 0.5, Updated: start}, start)
+	want := Result{Allowed: false, Reset: 9500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}
+	if result != want || bucket.Tokens != 0.5 {
+		t.Errorf("Take() of half a token = %+v, %+v, want %+v keeping the half", bucket, result, want)
+	}
+
+	bucket, result = limit.Take(bucket, start.Add(2500*time.Millisecond))
+	if !result.Allowed || result.Remaining != 2 || bucket.Tokens != 2 {
+		t.Errorf("Take() after 2.5s = %+v, %+v, want three tokens refilled and one taken", bucket, result)
+	}
+	if bucket, _ = limit.Take(bucket, start.Add(time.Hour)); bucket.Tokens != 9 {
+		t.Errorf("tokens after an hour = %v, refill must stop at the limit", bucket.Tokens)
+	}
+}
+
+func TestTakeWithClockBehind(t *testing.T) {
+	limit := Limit{Requests: 10, Period: 10 * time.Second}
+	bucket, result := limit.Take(Bucket{Tokens: 0, Updated: start}, start.Add(-time.Minute))
+	if result.Allowed || bucket.Tokens != 0 || result.RetryAfter != time.Second {
+		t.Errorf("Take() by instance with clock behind = %+v, %+v, want no tokens back", bucket, result)
+	}
+}
+
+func TestMemoryStoreKeepsBucketsApart(t *testing.T) {
+	s := NewMemoryStore().(*memoryStore)
+	limit := Limit{Requests: 2, Period: time.Minute}
+	ctx := context.Background()
+	for i, want := range []bool{true, true, false} {
+		if result, _ := s.Take(ctx, "ip:1", limit, start); result.Allowed != want {
+			t.Errorf("request %d of burst allowed = %v, want %v", i+1, result.Allowed, want)
+		}
+	}
+	if result, _ := s.Take(ctx, "ip:2", limit, start); !result.Allowed {
+		t.Error("other client is limited by bucket of the first one")
+	}
+
+	// Bucket of ip:2 is full again after half a minute, the slow one is not
+	s.Take(ctx, "ip:slow", Limit{Requests: 2, Period: time.Hour}, start)
+	s.Take(ctx, "ip:3", limit, start.Add(sweepInterval+time.Second))
+	if _, ok := s.buckets["ip:2"]; ok {
+		t.Error("full bucket is not swept")
+	}
+	if _, ok := s.buckets["ip:slow"]; !ok {
+		t.Error("bucket which is not full yet is swept")
+	}
+}
+
+func TestMiddlewareRejectsBeyondLimit(t *testing.T) {
+	useSettings(t, []config.RatePolicy{
+		{Name: "sign-in", Routes: []string{"/api/v2/sessions"}, Methods: []string{"post"}, Key: keyIp, Limit: 2, Period: time.Minute},
+	}, nil)
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/v2/sessions", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST", "DELETE")
+
+	send := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, "/api/v2/sessions", nil)
+		request.RemoteAddr = "203.0.113.7:5000"
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	send("POST")
+	if recorder := send("POST"); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("last request of limit = %d, remaining %s", recorder.Code, recorder.Header().Get("RateLimit-Remaining"))
+	}
+	recorder := send("POST")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") != "30" {
+		t.Errorf("request beyond limit = %d, Retry-After %q, want 429 after 30 seconds", recorder.Code, recorder.Header().Get("Retry-After"))
+	}
+	if recorder.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("RateLimit-Policy = %q", recorder.Header().Get("RateLimit-Policy"))
+	}
+	if recorder = send("DELETE"); recorder.Code != http.StatusOK || recorder.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("request of method without policy = %d, %v", recorder.Code, recorder.Header())
+	}
+}
+
+func TestClientIpBehindProxies(t *testing.T) {
+	useSettings(t, nil, []string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1"})
+	tests := []struct {
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{remote: "203.0.113.7:5000", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7"},
+		{remote: "192.0.2.1:5000", forwarded: []string{"198.51.100.1"}, want: "198.51.100.1"},
+		{remote: "192.0.2.2:5000", forwarded: []string{"198.51.100.1"}, want: "192.0.2.2"},
+		// Client may send its own header, only addresses added by proxies count
+		{remote: "10.0.0.2:5000", forwarded: []string{"1.2.3.4, 198.51.100.1, 10.0.0.3"}, want: "198.51.100.1"},
+		{remote: "10.0.0.2:5000", forwarded: []string{"1.2.3.4", "198.51.100.1"}, want: "198.51.100.1"},
+		{remote: "10.0.0.2:5000", forwarded: []string{"1.2.3.4, unknown"}, want: "10.0.0.2"},
+		{remote: "[2001:db8:1:2:3:4:5:6]:5000", want: "2001:db8:1:2::"},
+		{remote: "[2001:db8::1]:5000", forwarded: []string{"2001:db8:9:9::1"}, want: "2001:db8:9:9::"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/api/v2/users/me", nil)
+		request.RemoteAddr = test.remote
+		for _, forwarded := range test.forwarded {
+			request.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if got := clientIp(request); got != test.want {
+			t.Errorf("clientIp() of %s forwarding %q = %s, want %s", test.remote, test.forwarded, got, test.want)
+		}
+	}
+}
+
+/* Init limits with policies and proxies, settings of other tests are restored after the test */
+func useSettings(t *testing.T, ratePolicies []config.RatePolicy, proxies []string) {
+	previousEnabled, previousPolicies, previousProxies, previousStore := enabled, policies, trustedProxies, store
+	t.Cleanup(func() {
+		enabled, policies, trustedProxies, store = previousEnabled, previousPolicies, previousProxies, previousStore
+	})
+	cfg := new(config.Config)
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.Policies = ratePolicies
+	cfg.RateLimit.TrustedProxies = proxies
+	Init(cfg)
+	UseStore(NewMemoryStore())
+}
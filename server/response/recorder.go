@@ -0,0 +1,58 @@
+package response
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+/**
+ * Recorder of status code and size of response,
+ * shared by middlewares which report them
+ */
+
+type Recorder struct {
+	http.ResponseWriter
+	Status      int
+	Bytes       int
+	wroteHeader bool
+}
+
+func NewRecorder(writer http.ResponseWriter) *Recorder {
+	if recorder, ok := writer.(*Recorder); ok {
+		return recorder
+	}
+	return &Recorder{ResponseWriter: writer, Status: http.StatusOK}
+}
+
+func (r *Recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.Status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *Recorder) Write(body []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(body)
+	r.Bytes += n
+	return n, err
+}
+
+func (r *Recorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+/* WebSockets take over the connection */
+func (r *Recorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	r.Status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
@@ -0,0 +1,129 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"social-network-study/config"
+	"social-network-study/model/auth"
+	"social-network-study/model/user"
+	"social-network-study/rpc/userpb"
+	"social-network-study/security"
+	"strings"
+	"time"
+)
+
+/**
+ * gRPC API for backend services. It shares the service layer
+ * with REST API and accepts the same tokens, passed in
+ * metadata as "authorization: Bearer TOKEN"
+ */
+
+var server *grpc.Server
+
+type principalKey struct{}
+
+/* Listen on gRPC port and serve in background, disabled by empty port */
+func Start(cfg *config.Config) {
+	if cfg.Server.GrpcPort == "" {
+		return
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Server.GrpcPort))
+	if err != nil {
+		log.Fatalf("Cannot listen gRPC port... %v", err)
+	}
+	options := []grpc.ServerOption{grpc.ChainUnaryInterceptor(logCall, authenticate)}
+	if tlsConfig := security.TLSConfig(); tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server = grpc.NewServer(options...)
+	userpb.RegisterUserServiceServer(server, new(userService))
+	go func() {
+		log.WithFields(log.Fields{"port": cfg.Server.GrpcPort, "tls": cfg.TLSEnabled()}).Info("gRPC server was started")
+		if err := server.Serve(listener); err != nil {
+			log.WithError(err).Error("gRPC server failed")
+		}
+	}()
+}
+
+/* Finish in-flight calls, cancel them when context is done */
+func Stop(ctx context.Context) {
+	if server == nil {
+		return
+	}
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Info("gRPC server stopped")
+	case <-ctx.Done():
+		server.Stop()
+		log.Warn("gRPC calls were not finished in time")
+	}
+}
+
+/* Access log line of every call */
+func logCall(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	code := status.Code(err)
+	entry := log.WithFields(log.Fields{
+		"method":      info.FullMethod,
+		"code":        code.String(),
+		"duration_ms": float64(time.Since(start).Microseconds()) / 1000,
+	})
+	if code == codes.Internal || code == codes.Unknown {
+		entry.WithError(err).Error("Call failed")
+	} else {
+		entry.Info("Call served")
+	}
+	return resp, err
+}
+
+/* Check token of metadata and pass its user to the call */
+func authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "authorization token must be present")
+	}
+	token := values[0][7:] //7 corresponds to "Bearer "
+	if valid, err := auth.ValidateToken(token); !valid {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	login, err := auth.GetLoginByToken(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	principal, err := user.FetchUserByLogin(ctx, login)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if principal.ID == 0 {
+		return nil, status.Error(codes.Unauthenticated, "user of token does not exist")
+	}
+	return handler(context.WithValue(ctx, principalKey{}, principal), req)
+}
+
+/* User of token, set by authenticate */
+func currentPrincipal(ctx context.Context) *user.User {
+	principal, _ := ctx.Value(principalKey{}).(*user.User)
+	return principal
+}
+
+/* Same rule as CheckForbidden of REST API */
+func checkForbidden(ctx context.Context, id int) error {
+	if principal := currentPrincipal(ctx); principal == nil || principal.ID != id {
+		return status.Error(codes.PermissionDenied, "forbidden request")
+	}
+	return nil
+}
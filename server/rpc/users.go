@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"social-network-study/model/user"
+	"social-network-study/rpc/userpb"
+)
+
+//go:generate protoc -I userpb --go_out=userpb --go_opt=paths=source_relative --go-grpc_out=userpb --go-grpc_opt=paths=source_relative user.proto
+
+/* UserService over functions of model/user */
+type userService struct {
+	userpb.UnimplementedUserServiceServer
+}
+
+func (s *userService) GetCurrentUser(ctx context.Context, request *userpb.GetCurrentUserRequest) (*userpb.User, error) {
+	return toUser(currentPrincipal(ctx)), nil
+}
+
+func (s *userService) GetUser(ctx context.Context, request *userpb.GetUserRequest) (*userpb.User, error) {
+	found, err := user.FetchUserById(ctx, int(request.Id))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if found.ID == 0 {
+		return nil, status.Errorf(codes.NotFound, "user %d does not exist", request.Id)
+	}
+	return toUser(found), nil
+}
+
+func (s *userService) SearchUsers(ctx context.Context, request *userpb.SearchUsersRequest) (*userpb.FriendList, error) {
+	friends, err := user.FetchFullUsers(ctx, request.Search, 0)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toFriendList(friends), nil
+}
+
+func (s *userService) ListFriends(ctx context.Context, request *userpb.ListFriendsRequest) (*userpb.FriendList, error) {
+	friends, err := user.FetchFriends(ctx, int(request.UserId), request.Search)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toFriendList(friends), nil
+}
+
+func (s *userService) ListUnknownUsers(ctx context.Context, request *userpb.ListFriendsRequest) (*userpb.FriendList, error) {
+	friends, err := user.FetchUnknownUsers(ctx, int(request.UserId), request.Search)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return toFriendList(friends), nil
+}
+
+func (s *userService) AddFriend(ctx context.Context, request *userpb.Relationship) (*userpb.Relationship, error) {
+	if err := checkForbidden(ctx, int(request.UserId)); err != nil {
+		return nil, err
+	}
+	_, err := user.AddFriend(ctx, fromRelationship(request))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return request, nil
+}
+
+func (s *userService) RemoveFriend(ctx context.Context, request *userpb.Relationship) (*userpb.Relationship, error) {
+	if err := checkForbidden(ctx, int(request.UserId)); err != nil {
+		return nil, err
+	}
+	_, err := user.RemoveFriend(ctx, fromRelationship(request))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return request, nil
+}
+
+func toUser(u *user.User) *userpb.User {
+	return &userpb.User{
+		Id:        int64(u.ID),
+		Login:     u.Login,
+		FirstName: u.FirstName,
+		LastName:  u.LastName,
+		BirthDay:  u.BirthDay,
+		Gender:    value(u.Gender),
+		Interests: value(u.Interests),
+		City:      value(u.City),
+		Presence:  toPresence(u.Online, u.LastSeen),
+	}
+}
+
+func toFriendList(friends []*user.Friend) *userpb.FriendList {
+	list := &userpb.FriendList{Friends: make([]*userpb.Friend, 0, len(friends))}
+	for _, f := range friends {
+		list.Friends = append(list.Friends, &userpb.Friend{
+			Id:        int64(f.ID),
+			FirstName: f.FirstName,
+			LastName:  f.LastName,
+			City:      value(f.City),
+			IsNew:     f.IsNew,
+			Presence:  toPresence(f.Online, f.LastSeen),
+		})
+	}
+	return list
+}
+
+/* Presence is unset for users who hide it */
+func toPresence(online *bool, lastSeen *string) *userpb.Presence {
+	if online == nil {
+		return nil
+	}
+	return &userpb.Presence{Online: *online, LastSeen: value(lastSeen)}
+}
+
+func fromRelationship(r *userpb.Relationship) *user.Relationship {
+	return &user.Relationship{UserId: int(r.UserId), FriendId: int(r.FriendId)}
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,45 @@
+package security
+
+import (
+	"github.com/gorilla/handlers"
+	"net/http"
+	"social-network-study/config"
+)
+
+/**
+CORS of configured origins. Without origins only pages
+of the server itself call the API, as the client does,
+and preflights of other pages are denied
+*/
+func Cors(cfg *config.Config) func(http.Handler) http.Handler {
+	// Handlers of gorilla allow every origin when the list is empty
+	if len(cfg.Cors.AllowedOrigins) == 0 {
+		return denyPreflights
+	}
+	options := []handlers.CORSOption{
+		handlers.AllowedOrigins(cfg.Cors.AllowedOrigins),
+		handlers.AllowedMethods(cfg.Cors.AllowedMethods),
+		handlers.AllowedHeaders(cfg.Cors.AllowedHeaders),
+		handlers.ExposedHeaders(cfg.Cors.ExposedHeaders),
+		handlers.MaxAge(int(cfg.Cors.MaxAge.Seconds())),
+	}
+	if cfg.Cors.AllowCredentials {
+		options = append(options, handlers.AllowCredentials())
+	}
+	return handlers.CORS(options...)
+}
+
+/* Preflights would otherwise get 200 of the client application */
+func denyPreflights(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPreflight(r) {
+			http.Error(w, "cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
@@ -0,0 +1,60 @@
+package security
+
+import (
+	"fmt"
+	"net/http"
+	"social-network-study/config"
+	"social-network-study/ratelimit"
+	"strings"
+)
+
+/**
+ * Security headers of every response, including static
+ * files and the client application
+ */
+
+var contentSecurityPolicy string
+var strictTransportSecurity string
+var frameOptions string
+var referrerPolicy string
+
+func Init(cfg *config.Config) {
+	contentSecurityPolicy = cfg.Headers.ContentSecurityPolicy
+	if cfg.Headers.HstsMaxAge > 0 {
+		strictTransportSecurity = fmt.Sprintf("max-age=%d; includeSubDomains", int(cfg.Headers.HstsMaxAge.Seconds()))
+	}
+	frameOptions = cfg.Headers.FrameOptions
+	referrerPolicy = cfg.Headers.ReferrerPolicy
+	initTLS(cfg)
+}
+
+/* Middleware setting headers which are configured */
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if contentSecurityPolicy != "" {
+			header.Set("Content-Security-Policy", contentSecurityPolicy)
+		}
+		if frameOptions != "" {
+			header.Set("X-Frame-Options", frameOptions)
+		}
+		if referrerPolicy != "" {
+			header.Set("Referrer-Policy", referrerPolicy)
+		}
+		// Browsers ignore HSTS received over plain HTTP
+		if strictTransportSecurity != "" && isHttps(r) {
+			header.Set("Strict-Transport-Security", strictTransportSecurity)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+/**
+Request came over TLS, directly or through a proxy terminating
+it. Only trusted proxies of rate limits are believed, anyone
+else may send X-Forwarded-Proto
+*/
+func isHttps(r *http.Request) bool {
+	return r.TLS != nil || ratelimit.FromTrustedProxy(r) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
@@ -0,0 +1,82 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"social-network-study/config"
+	"social-network-study/ratelimit"
+	"testing"
+	"time"
+)
+
+/* Handler of the client application, answering everything with 200 */
+var application = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("<html></html>"))
+})
+
+func TestCorsWithoutOrigins(t *testing.T) {
+	handler := Cors(&config.Config{})(application)
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		status  int
+	}{
+		{"preflight", "OPTIONS", map[string]string{"Origin": "https://evil.example", "Access-Control-Request-Method": "POST"}, http.StatusForbidden},
+		{"options without preflight headers", "OPTIONS", map[string]string{"Origin": "https://evil.example"}, http.StatusOK},
+		{"request of the same origin", "GET", map[string]string{}, http.StatusOK},
+		{"simple cross-origin request", "GET", map[string]string{"Origin": "https://evil.example"}, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "/api/v2/users/me", nil)
+			for name, value := range test.headers {
+				request.Header.Set(name, value)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Errorf("%s = %d, want %d", test.name, recorder.Code, test.status)
+			}
+			if origin := recorder.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+				t.Errorf("%s allows origin %q", test.name, origin)
+			}
+		})
+	}
+}
+
+func TestHstsBehindTrustedProxy(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Headers.HstsMaxAge = time.Hour
+	cfg.RateLimit.TrustedProxies = []string{"10.0.0.0/8"}
+	Init(cfg)
+	ratelimit.Init(cfg)
+	defer ratelimit.Init(&config.Config{})
+	handler := Middleware(application)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		want       bool
+	}{
+		{"trusted proxy terminating TLS", "10.1.2.3:4000", "https", true},
+		{"trusted proxy of plain HTTP", "10.1.2.3:4000", "http", false},
+		{"client claiming TLS", "203.0.113.7:4000", "https", false},
+		{"client without header", "203.0.113.7:4000", "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = test.remoteAddr
+			if test.proto != "" {
+				request.Header.Set("X-Forwarded-Proto", test.proto)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if got := recorder.Header().Get("Strict-Transport-Security") != ""; got != test.want {
+				t.Errorf("%s sets HSTS %v, want %v", test.name, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package security
+
+import (
+	"crypto/tls"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"social-network-study/config"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+ * Certificate of HTTPS and gRPC. Its files are checked
+ * periodically, renewed certificate is used by new
+ * connections without restart
+ */
+
+var certificate atomic.Value
+var certFile string
+var keyFile string
+var httpsPort string
+
+/* Load certificate of server and watch its files, nothing without TLS */
+func initTLS(cfg *config.Config) {
+	if !cfg.TLSEnabled() {
+		return
+	}
+	certFile = cfg.Server.TLS.CertFile
+	keyFile = cfg.Server.TLS.KeyFile
+	httpsPort = cfg.Server.Port
+
+	modified, err := loadCertificate()
+	if err != nil {
+		log.Fatalf("Cannot load TLS certificate... %v", err)
+	}
+	if cfg.Server.TLS.ReloadInterval > 0 {
+		go watchCertificate(modified, cfg.Server.TLS.ReloadInterval)
+	}
+}
+
+/**
+TLS settings of servers with HTTP/2 and the current
+certificate, nil when TLS is not configured
+*/
+func TLSConfig() *tls.Config {
+	if certificate.Load() == nil {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return certificate.Load().(*tls.Certificate), nil
+		},
+	}
+}
+
+/* Redirect plain HTTP request to the same URL on HTTPS port */
+func RedirectToHttps(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = strings.Trim(r.Host, "[]")
+	}
+	if httpsPort != "443" {
+		host = net.JoinHostPort(host, httpsPort)
+	}
+	target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+	// Permanent redirect which keeps method and body
+	http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+}
+
+/* Load key pair and return the latest modification time of its files */
+func loadCertificate() (time.Time, error) {
+	modified, err := modificationTime()
+	if err != nil {
+		return modified, err
+	}
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return modified, err
+	}
+	certificate.Store(&pair)
+	return modified, nil
+}
+
+/**
+Reload certificate when its files change. Files may be
+replaced one by one, a pair which does not match is
+retried on the next check while the old one is served
+*/
+func watchCertificate(modified time.Time, interval time.Duration) {
+	for range time.Tick(interval) {
+		current, err := modificationTime()
+		if err != nil || current.Equal(modified) {
+			continue
+		}
+		if current, err = loadCertificate(); err != nil {
+			log.WithError(err).Warn("Cannot reload TLS certificate, the previous one is served")
+			continue
+		}
+		modified = current
+		log.WithField("certFile", certFile).Info("TLS certificate was reloaded")
+	}
+}
+
+func modificationTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, path := range []string{certFile, keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"social-network-study/generate"
+	"time"
+)
+
+/**
+Subcommand filling database with generated users, friendships,
+posts and messages. Logins are prefix and number, the same
+options and seed give the same data
+*/
+func seedCommand(args []string) {
+	options := generate.DefaultOptions()
+	flags := newFlagSet("seed", "")
+	flags.IntVar(&options.Users, "users", options.Users, "Number of users to create")
+	flags.Float64Var(&options.Friends, "friends", options.Friends, "Average number of friends of user")
+	flags.Float64Var(&options.Exponent, "exponent", options.Exponent, "Exponent of power-law distribution of friends, greater than 2")
+	flags.Float64Var(&options.Posts, "posts", options.Posts, "Average number of posts of user")
+	flags.Float64Var(&options.Dialogs, "dialogs", options.Dialogs, "Average number of dialogs of user")
+	flags.Float64Var(&options.Messages, "messages", options.Messages, "Average number of messages in dialog")
+	flags.StringVar(&options.Password, "password", options.Password, "Password of every user")
+	flags.StringVar(&options.Prefix, "prefix", options.Prefix, "Prefix of logins, change it to seed again")
+	flags.IntVar(&options.BatchSize, "batch", options.BatchSize, "Number of rows inserted by one statement")
+	flags.Int64Var(&options.Seed, "seed", options.Seed, "Seed of random generator")
+	flags.Var(dateFlag{&options.Until}, "until", "Date generated data ends with, data covers the year before")
+	asJson := flags.Bool("json", false, "Print report as JSON")
+	cfg := loadConfig(flags, args)
+	if cfg == nil {
+		return
+	}
+	requireArgs(flags, 0)
+	if err := options.Validate(); err != nil {
+		log.Fatalf("Invalid options... %v", err)
+	}
+
+	connect(cfg, false)
+	defer disconnect()
+
+	report, err := generate.Run(context.Background(), options)
+	if err != nil {
+		log.Fatalf("Seeding failed... %v", err)
+	}
+	if *asJson {
+		err = json.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		err = report.Print(os.Stdout)
+	}
+	if err != nil {
+		log.Fatalf("Cannot print report... %v", err)
+	}
+}
+
+/* Flag of date in format of generate.DateLayout */
+type dateFlag struct {
+	date *time.Time
+}
+
+func (f dateFlag) String() string {
+	if f.date == nil {
+		return ""
+	}
+	return f.date.Format(generate.DateLayout)
+}
+
+func (f dateFlag) Set(value string) error {
+	date, err := time.Parse(generate.DateLayout, value)
+	if err != nil {
+		return err
+	}
+	*f.date = date
+	return nil
+}
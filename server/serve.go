@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"social-network-study/config"
+	"social-network-study/deprecation"
+	"social-network-study/gql"
+	"social-network-study/logging"
+	"social-network-study/metrics"
+	"social-network-study/model/auth"
+	"social-network-study/model/counter"
+	"social-network-study/model/dialog"
+	"social-network-study/model/health"
+	"social-network-study/model/post"
+	"social-network-study/model/presence"
+	"social-network-study/model/user"
+	"social-network-study/openapi"
+	"social-network-study/ratelimit"
+	"social-network-study/rpc"
+	"social-network-study/security"
+	"social-network-study/tracing"
+	"syscall"
+	"time"
+)
+
+/* Subcommand serving the API and the client application */
+func serveCommand(args []string) {
+	cfg := loadConfig(newFlagSet("serve", ""), args)
+	if cfg == nil {
+		return
+	}
+	tracing.Init(cfg)
+	auth.Init(cfg)
+	connect(cfg, cfg.Database.AutoMigrate)
+	counter.Start(cfg)
+	presence.Init(cfg)
+	health.Init(cfg)
+	openapi.Init(cfg)
+	deprecation.Init(cfg)
+	gql.Init(cfg)
+	security.Init(cfg)
+	ratelimit.Init(cfg)
+
+	router := newRouter()
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%s", cfg.Server.Port),
+		Handler:           logging.Middleware(security.Middleware(security.Cors(cfg)(router))),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		TLSConfig:         security.TLSConfig(),
+	}
+	server.RegisterOnShutdown(presence.CloseSockets)
+	servers := []*http.Server{server}
+	rpc.Start(cfg)
+
+	errs := make(chan error, 2)
+	go func() {
+		log.WithFields(log.Fields{"port": cfg.Server.Port, "tls": cfg.TLSEnabled()}).Info("Server was started")
+		if cfg.TLSEnabled() {
+			// Certificate comes from TLSConfig, HTTP/2 is negotiated by ALPN
+			errs <- server.ListenAndServeTLS("", "")
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+	if cfg.Server.TLS.RedirectPort != "" {
+		redirect := &http.Server{
+			Addr:              fmt.Sprintf(":%s", cfg.Server.TLS.RedirectPort),
+			Handler:           logging.Middleware(http.HandlerFunc(security.RedirectToHttps)),
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		servers = append(servers, redirect)
+		go func() {
+			log.WithField("port", cfg.Server.TLS.RedirectPort).Info("Redirect to HTTPS was started")
+			errs <- redirect.ListenAndServe()
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		log.WithError(err).Error("Server failed")
+	case sig := <-signals:
+		log.WithField("signal", sig.String()).Info("Shutting down")
+	}
+	shutdown(servers, cfg.Server.ShutdownTimeout)
+}
+
+/* Routes of both versions of API, meta endpoints and the client application */
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(metrics.Middleware)
+	router.Use(tracing.Middleware)
+	router.Use(ratelimit.Middleware)
+
+	apiRoot := router.PathPrefix("/api/v1").Subrouter()
+	apiRoot.Use(deprecation.Middleware)
+	apiRoot.Use(openapi.Middleware)
+	apiRoot.HandleFunc("/singin", user.SingIn).Methods("POST")
+	apiRoot.HandleFunc("/singup", user.SingUp).Methods("POST")
+	apiRoot.HandleFunc("/singup/{login}", user.GetCheckLogin).Methods("GET")
+	sharedPublicRoutes(apiRoot)
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(deprecation.Middleware)
+	api.Use(openapi.Middleware)
+	api.Use(auth.Secure)
+	api.Use(presence.Track)
+	api.HandleFunc("/current-user", user.GetCurrentUser).Methods("GET")
+	api.HandleFunc("/users/{id}", user.GetUser).Methods("GET")
+	api.HandleFunc("/users/{id}", user.DeleteUser).Methods("DELETE")
+	api.HandleFunc("/users", user.UpdateUser).Methods("PUT")
+	api.HandleFunc("/friends/unknown", user.GetUnknownUsers).Methods("GET")
+	api.HandleFunc("/friends/full", user.GetFullUsers).Methods("GET")
+	api.HandleFunc("/friends", user.GetFriends).Methods("GET")
+	api.HandleFunc("/friends", user.PostAddFriend).Methods("POST")
+	api.HandleFunc("/friends", user.DeleteFriend).Methods("DELETE")
+	api.HandleFunc("/posts", post.GetPosts).Methods("GET")
+	sharedRoutes(api)
+
+	apiV2Root := router.PathPrefix("/api/v2").Subrouter()
+	apiV2Root.Use(openapi.Middleware)
+	apiV2Root.HandleFunc("/sessions", user.SingIn).Methods("POST")
+	apiV2Root.HandleFunc("/sessions/refresh", user.RefreshSession).Methods("POST")
+	apiV2Root.HandleFunc("/sessions", user.SignOut).Methods("DELETE")
+	apiV2Root.HandleFunc("/users", user.SingUp).Methods("POST")
+	apiV2Root.HandleFunc("/logins/{login}", user.GetCheckLogin).Methods("GET")
+	sharedPublicRoutes(apiV2Root)
+
+	apiV2 := router.PathPrefix("/api/v2").Subrouter()
+	apiV2.Use(openapi.Middleware)
+	apiV2.Use(auth.Secure)
+	apiV2.Use(presence.Track)
+	apiV2.HandleFunc("/users/me", user.GetCurrentUser).Methods("GET")
+	apiV2.HandleFunc("/users/{id:[0-9]+}", user.GetUser).Methods("GET")
+	apiV2.HandleFunc("/users/{id:[0-9]+}", user.UpdateUser).Methods("PUT")
+	apiV2.HandleFunc("/users/{id:[0-9]+}", user.DeleteUser).Methods("DELETE")
+	apiV2.HandleFunc("/users/{id:[0-9]+}/friends", user.GetFriends).Methods("GET")
+	apiV2.HandleFunc("/users/{id:[0-9]+}/friends/{friendId:[0-9]+}", user.PostAddFriend).Methods("PUT")
+	apiV2.HandleFunc("/users/{id:[0-9]+}/friends/{friendId:[0-9]+}", user.DeleteFriend).Methods("DELETE")
+	apiV2.HandleFunc("/users/{id:[0-9]+}/non-friends", user.GetUnknownUsers).Methods("GET")
+	apiV2.HandleFunc("/users/{id:[0-9]+}/posts", post.GetPosts).Methods("GET")
+	apiV2.HandleFunc("/search/users", user.GetFullUsers).Methods("GET")
+	sharedRoutes(apiV2)
+
+	// GraphQL is not versioned, its schema evolves by deprecating fields
+	router.Handle("/graphql", openapi.Middleware(auth.Secure(presence.Track(http.HandlerFunc(gql.PostQuery))))).Methods("POST")
+
+	router.HandleFunc("/healthz", health.GetLiveness).Methods("GET")
+	router.HandleFunc("/readyz", health.GetReadiness).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./html/static/"))))
+
+	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r,"./html/index.html")
+	})
+	return router
+}
+
+/* Public routes which are the same in every version of API */
+func sharedPublicRoutes(api *mux.Router) {
+	api.HandleFunc("/presence/ws", presence.GetSocket).Methods("GET")
+	api.HandleFunc("/openapi.json", openapi.GetDocument).Methods("GET")
+}
+
+/* Routes which are the same in every version of API */
+func sharedRoutes(api *mux.Router) {
+	api.HandleFunc("/dialogs", dialog.GetDialogs).Methods("GET")
+	api.HandleFunc("/dialogs/{id}/messages", dialog.GetMessages).Methods("GET")
+	api.HandleFunc("/dialogs/{id}/messages", dialog.PostMessage).Methods("POST")
+	api.HandleFunc("/dialogs/{id}/read", dialog.PutRead).Methods("PUT")
+	api.HandleFunc("/counters", counter.GetCounters).Methods("GET")
+	api.HandleFunc("/presence", presence.GetPresence).Methods("GET")
+	api.HandleFunc("/presence/settings", presence.PutSettings).Methods("PUT")
+	api.HandleFunc("/posts", post.PostPost).Methods("POST")
+	api.HandleFunc("/posts/{id}", post.GetPost).Methods("GET")
+	api.HandleFunc("/posts/{id}/likes", post.PutLike).Methods("PUT")
+	api.HandleFunc("/posts/{id}/likes", post.DeleteLike).Methods("DELETE")
+	api.HandleFunc("/posts/{id}/comments", post.GetComments).Methods("GET")
+	api.HandleFunc("/posts/{id}/comments", post.PostComment).Methods("POST")
+}
+
+/**
+Stop accepting connections and drain in-flight requests,
+then stop background workers and close databases
+*/
+func shutdown(servers []*http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	log.WithField("timeout", timeout.String()).Info("Draining connections")
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.WithError(err).WithField("addr", server.Addr).Warn("Connections were not drained in time")
+		} else {
+			log.WithField("addr", server.Addr).Info("HTTP server stopped")
+		}
+	}
+	rpc.Stop(ctx)
+
+	counter.Stop()
+	log.Info("Background workers stopped")
+	tracing.Shutdown(ctx)
+	log.Info("Spans exported")
+	config.CloseShards()
+	log.Info("Dialog shards closed")
+	config.CloseDataBase()
+	log.Info("Database closed, bye")
+}
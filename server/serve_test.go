@@ -0,0 +1,123 @@
+package main
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"social-network-study/config"
+	"social-network-study/openapi"
+	"testing"
+	"time"
+)
+
+/* Variables of routes with patterns, e.g. {id:[0-9]+} */
+var routeVariable = regexp.MustCompile(`\{(\w+):[^}]+\}`)
+
+func TestRoutesAreDocumented(t *testing.T) {
+	spec, err := openapi.Load("openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := make(map[string]bool)
+	err = newRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Prefixes of versions, static files and the client application
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		template = routeVariable.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			routes[method+" "+template] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	documented := make(map[string]bool)
+	for path, item := range spec.Paths {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("route %s is not documented", route)
+		}
+	}
+	for operation := range documented {
+		if !routes[operation] {
+			t.Errorf("documented operation %s has no route", operation)
+		}
+	}
+}
+
+/**
+Requests which are answered without database, so that
+handlers and middlewares are checked against document
+*/
+func TestHandlersFollowDocument(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.OpenAPI = "openapi.yaml"
+	openapi.Init(cfg)
+	spec, err := openapi.Load(cfg.Server.OpenAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"login": "test",
+		"uid":   1,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret of another issuer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		token    string
+		status   int
+		rejected bool
+	}{
+		{"liveness", "GET", "/healthz", "", http.StatusOK, false},
+		{"document", "GET", "/api/v2/openapi.json", "", http.StatusOK, false},
+		{"deprecated document", "GET", "/api/v1/openapi.json", "", http.StatusOK, false},
+		{"token of another issuer", "GET", "/api/v2/users/me", foreign, http.StatusBadRequest, false},
+		{"deprecated route with token of another issuer", "GET", "/api/v1/current-user", foreign, http.StatusBadRequest, false},
+		{"read marks with token of another issuer", "PUT", "/api/v2/dialogs/2/read?id=1", foreign, http.StatusBadRequest, false},
+		{"read marks without id of user", "PUT", "/api/v2/dialogs/2/read", foreign, http.StatusBadRequest, true},
+		{"messages with id of wrong type", "GET", "/api/v2/dialogs/2/messages?id=one", foreign, http.StatusBadRequest, true},
+		{"undocumented route", "GET", "/api/v2/unknown", "", http.StatusNotFound, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := make([]error, 0)
+			handler := openapi.StrictValidator(spec, func(r *http.Request, err error) {
+				violations = append(violations, err)
+			})(newRouter())
+
+			request := httptest.NewRequest(test.method, test.target, nil)
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if recorder.Code != test.status {
+				t.Errorf("%s %s = %d %q, want %d", test.method, test.target, recorder.Code, recorder.Body.String(), test.status)
+			}
+			if test.rejected != (len(violations) > 0) {
+				t.Errorf("%s %s reported violations %v, want rejected %v", test.method, test.target, violations, test.rejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/api/global"
+	"go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/exporters/otlp"
+	"go.opentelemetry.io/otel/exporters/stdout"
+	"go.opentelemetry.io/otel/label"
+	"go.opentelemetry.io/otel/propagators"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/semconv"
+	"net/http"
+	"social-network-study/config"
+	"social-network-study/response"
+)
+
+/**
+ * OpenTelemetry tracing of HTTP routes and service functions.
+ * Trace context of callers is taken from W3C traceparent header,
+ * spans are exported to stdout or OTLP collector
+ */
+
+const instrumentationName = "social-network-study"
+
+var exporter export.SpanExporter
+var processor *sdktrace.BatchSpanProcessor
+
+/* Install exporter, without it spans are not recorded */
+func Init(cfg *config.Config) {
+	global.SetTextMapPropagator(otel.NewCompositeTextMapPropagator(propagators.TraceContext{}, propagators.Baggage{}))
+
+	var err error
+	switch cfg.Tracing.Exporter {
+	case "none", "":
+		return
+	case "stdout":
+		exporter, err = stdout.NewExporter(stdout.WithoutMetricExport())
+	case "otlp":
+		options := []otlp.ExporterOption{otlp.WithInsecure()}
+		if cfg.Tracing.Endpoint != "" {
+			options = append(options, otlp.WithAddress(cfg.Tracing.Endpoint))
+		}
+		exporter, err = otlp.NewExporter(options...)
+	default:
+		err = fmt.Errorf("unknown exporter %s", cfg.Tracing.Exporter)
+	}
+	if err != nil {
+		log.Fatalf("Cannot start tracing... %v", err)
+	}
+
+	processor = sdktrace.NewBatchSpanProcessor(exporter)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithConfig(sdktrace.Config{
+			DefaultSampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio)),
+		}),
+		sdktrace.WithResource(resource.New(semconv.ServiceNameKey.String(cfg.Tracing.ServiceName))),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	global.SetTracerProvider(provider)
+	log.WithField("exporter", cfg.Tracing.Exporter).Info("Tracing started")
+}
+
+/* Export spans which are not exported yet */
+func Shutdown(ctx context.Context) {
+	if processor == nil {
+		return
+	}
+	processor.Shutdown()
+	if err := exporter.Shutdown(ctx); err != nil {
+		log.WithError(err).Warn("Cannot stop span exporter")
+	}
+}
+
+/**
+Start span of service function, use as
+ctx, span := tracing.Start(ctx, "user.FetchUserById")
+defer span.End()
+*/
+func Start(ctx context.Context, name string, attributes ...label.KeyValue) (context.Context, trace.Span) {
+	return global.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+/* Span of request named by mux route template, child of the caller's trace */
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(request); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		attributes := semconv.HTTPServerAttributesFromHTTPRequest("", route, request)
+		for i, attribute := range attributes {
+			// Query may carry token of WebSocket
+			if attribute.Key == semconv.HTTPTargetKey {
+				attributes[i] = semconv.HTTPTargetKey.String(request.URL.Path)
+			}
+		}
+		ctx := global.TextMapPropagator().Extract(request.Context(), request.Header)
+		ctx, span := global.Tracer(instrumentationName).Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attributes...),
+		)
+		defer span.End()
+
+		recorder := response.NewRecorder(writer)
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.Status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(recorder.Status))
+	})
+}
+